@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/CenterEdge/shawarma-webhook/httpd"
 	"github.com/CenterEdge/shawarma-webhook/routes"
@@ -17,7 +19,17 @@ type config struct {
 	shawarmaImage           string
 	shawarmaServiceAcctName string
 	shawarmaSecretTokenName string
-	nativeSidecars          bool
+	nativeSidecars          webhook.NativeSidecarMode
+	nativeSidecarInterval   time.Duration
+	defaultSideCar          string
+	tokens                  map[string]string
+	ignoreNamespaces        []string
+	onlyNamespaces          []string
+	imageLockFile           string
+	imageLockStrict         bool
+	verifyFailOpen          bool
+	serviceCheck            webhook.ServiceCheckMode
+	namespaceSelectors      bool
 }
 
 // Set on build
@@ -76,12 +88,18 @@ func main() {
 				Value:   "centeredge/shawarma:2.0.0-beta002",
 				Sources: cli.EnvVars("SHAWARMA_IMAGE"),
 			},
-			&cli.BoolFlag{
+			&cli.StringFlag{
 				Name:    "native-sidecars",
-				Usage:   "Use Kubernetes (>=1.29) native sidecars",
-				Value:   true,
+				Usage:   "Use Kubernetes (>=1.29) native sidecars (true, false, or auto to detect from the API server)",
+				Value:   "true",
 				Sources: cli.EnvVars("SHAWARMA_NATIVE_SIDECARS"),
 			},
+			&cli.DurationFlag{
+				Name:    "native-sidecars-interval",
+				Usage:   "Interval to recheck native sidecar support from the API server when native-sidecars is auto",
+				Value:   10 * time.Minute,
+				Sources: cli.EnvVars("SHAWARMA_NATIVE_SIDECARS_INTERVAL"),
+			},
 			&cli.StringFlag{
 				Name:    "shawarma-service-acct-name",
 				Usage:   "Name of the service account which should be used for sidecars (requires a legacy token secret linked to the service account)",
@@ -94,6 +112,54 @@ func main() {
 				Value:   "",
 				Sources: cli.EnvVars("SHAWARMA_SECRET_TOKEN_NAME"),
 			},
+			&cli.StringFlag{
+				Name:    "default-sidecar",
+				Usage:   "Comma-delimited list of sidecar templates to inject if not selected by annotation (defaults to shawarma, or shawarma-withtoken if a token secret is used)",
+				Value:   "",
+				Sources: cli.EnvVars("SHAWARMA_DEFAULT_SIDECAR"),
+			},
+			&cli.StringMapFlag{
+				Name:    "token",
+				Usage:   "Override the value of a custom token from the sidecar configuration, ex. NAME=value (may be repeated)",
+				Sources: cli.EnvVars("SHAWARMA_TOKENS"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "ignore-namespaces",
+				Usage:   "Namespaces where sidecars are never injected, may be names, globs like *-system, or regular expressions like /^team-.*$/",
+				Value:   webhook.SystemNameSpaces,
+				Sources: cli.EnvVars("SHAWARMA_IGNORE_NAMESPACES"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "only-namespaces",
+				Usage:   "If set, sidecars are only injected in matching namespaces, may be names, globs, or regular expressions",
+				Sources: cli.EnvVars("SHAWARMA_ONLY_NAMESPACES"),
+			},
+			&cli.StringFlag{
+				Name:    "image-lock-file",
+				Usage:   "File mapping injected images to images pinned by digest, reloaded when changed",
+				Sources: cli.EnvVars("SHAWARMA_IMAGE_LOCK_FILE"),
+			},
+			&cli.BoolFlag{
+				Name:    "image-lock-strict",
+				Usage:   "Reject pods if an injected image isn't pinned in the image lock file",
+				Sources: cli.EnvVars("SHAWARMA_IMAGE_LOCK_STRICT"),
+			},
+			&cli.StringFlag{
+				Name:    "service-check",
+				Usage:   "Check that the Service referenced by a pod exists (off, warn, or deny)",
+				Value:   "off",
+				Sources: cli.EnvVars("SHAWARMA_SERVICE_CHECK"),
+			},
+			&cli.BoolFlag{
+				Name:    "namespace-selectors",
+				Usage:   "Watch namespace labels so that match rules may use a namespaceSelector",
+				Sources: cli.EnvVars("SHAWARMA_NAMESPACE_SELECTORS"),
+			},
+			&cli.BoolFlag{
+				Name:    "verify-fail-open",
+				Usage:   "Admit pods without sidecars, rather than rejecting them, if injection would create an invalid pod",
+				Sources: cli.EnvVars("SHAWARMA_VERIFY_FAIL_OPEN"),
+			},
 		},
 		Before: func(ctx context.Context, c *cli.Command) (context.Context, error) {
 			// In case of empty environment variable, pull default here too
@@ -111,7 +177,10 @@ func main() {
 	}
 
 	app.Action = func(ctx context.Context, c *cli.Command) error {
-		conf := readConfig(c, logger)
+		conf, err := readConfig(c, logger)
+		if err != nil {
+			return err
+		}
 
 		if conf.shawarmaServiceAcctName != "" {
 			// If using a service account token, startup the monitor for service accounts
@@ -122,14 +191,32 @@ func main() {
 			}
 		}
 
+		if conf.nativeSidecars == webhook.NativeSidecarsAuto {
+			// Native sidecar support is detected using the Kubernetes API server
+			if err := webhook.InitializeKubernetesClient(); err != nil {
+				return fmt.Errorf("error initializing Kubernetes client for native sidecar detection: %w", err)
+			}
+		}
+
+		if conf.serviceCheck != webhook.ServiceCheckOff {
+			// Services are monitored using the Kubernetes API server
+			if err := webhook.InitializeKubernetesClient(); err != nil {
+				return fmt.Errorf("error initializing Kubernetes client for service checks: %w", err)
+			}
+		}
+
+		if conf.namespaceSelectors {
+			// Namespace labels are monitored using the Kubernetes API server
+			if err := webhook.InitializeKubernetesClient(); err != nil {
+				return fmt.Errorf("error initializing Kubernetes client for namespace selectors: %w", err)
+			}
+		}
+
 		simpleServer := httpd.NewSimpleServer(conf.httpdConf)
 
 		webhook.Init()
 
-		var (
-			mutator routes.MutatorController
-			err     error
-		)
+		var mutator routes.MutatorController
 
 		if mutator, err = addRoutes(simpleServer, conf); err != nil {
 			return err
@@ -154,20 +241,31 @@ func main() {
 
 func addRoutes(simpleServer httpd.SimpleServer, conf *config) (routes.MutatorController, error) {
 	mutator, err := routes.NewMutatorController(&webhook.MutatorConfig{
-		SideCarConfigFile:       conf.sideCarConfigFile,
-		ShawarmaImage:           conf.shawarmaImage,
-		NativeSidecars:          conf.nativeSidecars,
-		ShawarmaServiceAcctName: conf.shawarmaServiceAcctName,
-		ShawarmaSecretTokenName: conf.shawarmaSecretTokenName,
-		Logger:                  conf.httpdConf.Logger,
+		SideCarConfigFile:          conf.sideCarConfigFile,
+		ShawarmaImage:              conf.shawarmaImage,
+		NativeSidecars:             conf.nativeSidecars,
+		NativeSidecarCheckInterval: conf.nativeSidecarInterval,
+		ShawarmaServiceAcctName:    conf.shawarmaServiceAcctName,
+		ShawarmaSecretTokenName:    conf.shawarmaSecretTokenName,
+		DefaultSideCar:             conf.defaultSideCar,
+		Tokens:                     conf.tokens,
+		IgnoreNamespaces:           conf.ignoreNamespaces,
+		OnlyNamespaces:             conf.onlyNamespaces,
+		ImageLockFile:              conf.imageLockFile,
+		ImageLockStrict:            conf.imageLockStrict,
+		VerifyFailOpen:             conf.verifyFailOpen,
+		ServiceCheck:               conf.serviceCheck,
+		NamespaceSelectors:         conf.namespaceSelectors,
+		Logger:                     conf.httpdConf.Logger,
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	simpleServer.AddRoute("/mutate", mutator.Mutate)
+	simpleServer.AddRoute("/validate", mutator.Validate)
 
-	health, err := routes.NewHealthController(conf.httpdConf.Logger)
+	health, err := routes.NewHealthController(conf.httpdConf.Logger, mutator.Status)
 	if err != nil {
 		return nil, err
 	}
@@ -177,7 +275,17 @@ func addRoutes(simpleServer httpd.SimpleServer, conf *config) (routes.MutatorCon
 	return mutator, nil
 }
 
-func readConfig(c *cli.Command, logger *zap.Logger) *config {
+func readConfig(c *cli.Command, logger *zap.Logger) (*config, error) {
+	nativeSidecars, err := webhook.ParseNativeSidecarMode(c.String("native-sidecars"))
+	if err != nil {
+		return nil, err
+	}
+
+	serviceCheck, err := webhook.ParseServiceCheckMode(c.String("service-check"))
+	if err != nil {
+		return nil, err
+	}
+
 	conf := config{
 		httpdConf: httpd.Conf{
 			Port:     c.Uint16("port"),
@@ -189,8 +297,18 @@ func readConfig(c *cli.Command, logger *zap.Logger) *config {
 		shawarmaImage:           c.String("shawarma-image"),
 		shawarmaServiceAcctName: c.String("shawarma-service-acct-name"),
 		shawarmaSecretTokenName: c.String("shawarma-secret-token-name"),
-		nativeSidecars:          c.Bool("native-sidecars"),
+		nativeSidecars:          nativeSidecars,
+		nativeSidecarInterval:   c.Duration("native-sidecars-interval"),
+		defaultSideCar:          c.String("default-sidecar"),
+		tokens:                  c.StringMap("token"),
+		ignoreNamespaces:        c.StringSlice("ignore-namespaces"),
+		onlyNamespaces:          c.StringSlice("only-namespaces"),
+		imageLockFile:           c.String("image-lock-file"),
+		imageLockStrict:         c.Bool("image-lock-strict"),
+		verifyFailOpen:          c.Bool("verify-fail-open"),
+		serviceCheck:            serviceCheck,
+		namespaceSelectors:      c.Bool("namespace-selectors"),
 	}
 
-	return &conf
+	return &conf, nil
 }
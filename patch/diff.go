@@ -0,0 +1,43 @@
+package patch
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// Diff returns operations which transform the original JSON value into the modified value, where both values were
+// decoded from JSON into any. Objects are compared recursively, other values including arrays are replaced if changed.
+func Diff(original any, modified any) []Operation {
+	return diff(original, modified, "")
+}
+
+func diff(original any, modified any, path string) []Operation {
+	originalObject, ok := original.(map[string]any)
+	modifiedObject, ok2 := modified.(map[string]any)
+	if !ok || !ok2 {
+		if reflect.DeepEqual(original, modified) {
+			return nil
+		}
+
+		return []Operation{Replace(path, modified)}
+	}
+
+	var operations []Operation
+	for _, key := range slices.Sorted(maps.Keys(originalObject)) {
+		if _, ok := modifiedObject[key]; !ok {
+			operations = append(operations, Remove(Path(path, key)))
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(modifiedObject)) {
+		value, ok := originalObject[key]
+		if !ok {
+			operations = append(operations, Add(Path(path, key), modifiedObject[key]))
+		} else {
+			operations = append(operations, diff(value, modifiedObject[key], Path(path, key))...)
+		}
+	}
+
+	return operations
+}
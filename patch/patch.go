@@ -0,0 +1,114 @@
+/*
+Package patch builds JSON Patch (RFC 6902) operations for admission responses.
+*/
+package patch
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// OpAdd adds a value, replacing the value if the path is an existing object member
+	OpAdd = "add"
+	// OpReplace replaces an existing value
+	OpReplace = "replace"
+	// OpRemove removes an existing value
+	OpRemove = "remove"
+
+	// endOfList is the reference token which appends to a list
+	endOfList = "-"
+)
+
+// Operation is a single JSON Patch operation
+type Operation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// Escape escapes a JSON Pointer (RFC 6901) reference token, such as a map key containing / or ~
+func Escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// Path appends escaped reference tokens to a JSON Pointer, ex. Path("/metadata/labels", "app.kubernetes.io/name")
+func Path(base string, tokens ...string) string {
+	var builder strings.Builder
+	builder.WriteString(base)
+	for _, token := range tokens {
+		builder.WriteString("/")
+		builder.WriteString(Escape(token))
+	}
+	return builder.String()
+}
+
+// Add returns an operation which adds a value at the path
+func Add(path string, value any) Operation {
+	return Operation{Op: OpAdd, Path: path, Value: value}
+}
+
+// Replace returns an operation which replaces the value at the path
+func Replace(path string, value any) Operation {
+	return Operation{Op: OpReplace, Path: path, Value: value}
+}
+
+// Remove returns an operation which removes the value at the path
+func Remove(path string) Operation {
+	return Operation{Op: OpRemove, Path: path}
+}
+
+// AppendToList returns operations which append items to the list at the path. If the target list is empty it may
+// not exist, so the first item creates the list and the remaining items are appended.
+func AppendToList[T any](target []T, added []T, path string) []Operation {
+	var operations []Operation
+	exists := len(target) > 0
+	for _, item := range added {
+		if !exists {
+			exists = true
+			operations = append(operations, Add(path, []T{item}))
+		} else {
+			operations = append(operations, Add(Path(path, endOfList), item))
+		}
+	}
+	return operations
+}
+
+// InsertIntoList returns an operation which inserts an item into the list at the path before the index. The length is
+// the current length of the list, the list is created if empty and the item is appended if the index is the length.
+func InsertIntoList[T any](length int, index int, item T, path string) Operation {
+	switch {
+	case length == 0:
+		return Add(path, []T{item})
+	case index >= length:
+		return Add(Path(path, endOfList), item)
+	default:
+		return Add(Path(path, strconv.Itoa(index)), item)
+	}
+}
+
+// UpdateMap returns operations which add or replace keys in the map of strings at the path, such as annotations or
+// labels, in key order. Keys which already have the same value are skipped. If the target map is nil it may not
+// exist, so it is created with all of the added keys.
+func UpdateMap(target map[string]string, added map[string]string, path string) []Operation {
+	if len(added) == 0 {
+		return nil
+	}
+
+	if target == nil {
+		return []Operation{Add(path, added)}
+	}
+
+	var operations []Operation
+	for _, key := range slices.Sorted(maps.Keys(added)) {
+		value := added[key]
+		if existing, ok := target[key]; !ok {
+			operations = append(operations, Add(Path(path, key), value))
+		} else if existing != value {
+			operations = append(operations, Replace(Path(path, key), value))
+		}
+	}
+	return operations
+}
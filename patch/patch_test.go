@@ -0,0 +1,231 @@
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// apply applies the operations to a copy of the pod
+func apply(t *testing.T, pod *corev1.Pod, operations []Operation) *corev1.Pod {
+	t.Helper()
+
+	document, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patchBytes, err := json.Marshal(operations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := jsonpatch.DecodePatch(patchBytes)
+	if err != nil {
+		t.Fatalf("invalid patch %s: %v", patchBytes, err)
+	}
+
+	if document, err = decoded.Apply(document); err != nil {
+		t.Fatalf("failed to apply patch %s: %v", patchBytes, err)
+	}
+
+	var patched corev1.Pod
+	if err := json.Unmarshal(document, &patched); err != nil {
+		t.Fatal(err)
+	}
+	return &patched
+}
+
+func assertPod(t *testing.T, expected *corev1.Pod, actual *corev1.Pod) {
+	t.Helper()
+
+	if !equality.Semantic.DeepEqual(expected, actual) {
+		expectedJSON, _ := json.Marshal(expected)
+		actualJSON, _ := json.Marshal(actual)
+		t.Errorf("unexpected pod\nexpected: %s\nactual:   %s", expectedJSON, actualJSON)
+	}
+}
+
+func containers(names ...string) []corev1.Container {
+	var result []corev1.Container
+	for _, name := range names {
+		result = append(result, corev1.Container{Name: name, Image: name})
+	}
+	return result
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		token    string
+		expected string
+	}{
+		{"name", "name"},
+		{"app.kubernetes.io/name", "app.kubernetes.io~1name"},
+		{"example.com/a~b", "example.com~1a~0b"},
+		{"~1", "~01"},
+		{"~/", "~0~1"},
+	}
+
+	for _, test := range tests {
+		if actual := Escape(test.token); actual != test.expected {
+			t.Errorf("Escape(%q) = %q, expected %q", test.token, actual, test.expected)
+		}
+	}
+
+	if actual := Path("/metadata/annotations", "example.com/a~b"); actual != "/metadata/annotations/example.com~1a~0b" {
+		t.Errorf("unexpected path %q", actual)
+	}
+}
+
+func TestEscapeAppliesToAnnotations(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"existing": "value"}}}
+	added := map[string]string{
+		"example.com/a~b": "tilde",
+		"example.com/~1":  "escaped",
+	}
+
+	expected := pod.DeepCopy()
+	expected.Annotations["example.com/a~b"] = "tilde"
+	expected.Annotations["example.com/~1"] = "escaped"
+
+	assertPod(t, expected, apply(t, pod, UpdateMap(pod.Annotations, added, "/metadata/annotations")))
+}
+
+func TestAppendToList(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		added    []string
+		expected []string
+	}{
+		{"empty list", nil, []string{"a", "b"}, []string{"a", "b"}},
+		{"existing list", []string{"app"}, []string{"a", "b"}, []string{"app", "a", "b"}},
+		{"nothing added", []string{"app"}, nil, []string{"app"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: containers(test.existing...)}}
+			expected := &corev1.Pod{Spec: corev1.PodSpec{Containers: containers(test.expected...)}}
+
+			operations := AppendToList(pod.Spec.Containers, containers(test.added...), "/spec/containers")
+			assertPod(t, expected, apply(t, pod, operations))
+		})
+	}
+}
+
+func TestInsertIntoList(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		index    int
+		expected []string
+	}{
+		{"empty list", nil, 0, []string{"new"}},
+		{"first", []string{"a", "b", "c"}, 0, []string{"new", "a", "b", "c"}},
+		{"middle", []string{"a", "b", "c"}, 2, []string{"a", "b", "new", "c"}},
+		{"end", []string{"a", "b", "c"}, 3, []string{"a", "b", "c", "new"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{InitContainers: containers(test.existing...)}}
+			expected := &corev1.Pod{Spec: corev1.PodSpec{InitContainers: containers(test.expected...)}}
+
+			operation := InsertIntoList(len(test.existing), test.index, containers("new")[0], "/spec/initContainers")
+			assertPod(t, expected, apply(t, pod, []Operation{operation}))
+		})
+	}
+}
+
+func TestUpdateMap(t *testing.T) {
+	added := map[string]string{
+		"app.kubernetes.io/name": "web",
+		"tier":                   "frontend",
+		"unchanged":              "same",
+	}
+
+	tests := []struct {
+		name       string
+		existing   map[string]string
+		expected   map[string]string
+		operations int
+	}{
+		{
+			name:     "nil map",
+			existing: nil,
+			expected: added,
+			// The map is created with all of the keys
+			operations: 1,
+		},
+		{
+			name:     "existing map",
+			existing: map[string]string{"tier": "backend", "unchanged": "same", "other": "value"},
+			expected: map[string]string{
+				"app.kubernetes.io/name": "web",
+				"tier":                   "frontend",
+				"unchanged":              "same",
+				"other":                  "value",
+			},
+			// Unchanged keys are skipped
+			operations: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: test.existing}}
+			expected := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: test.expected}}
+
+			operations := UpdateMap(pod.Labels, added, "/metadata/labels")
+			if len(operations) != test.operations {
+				t.Errorf("expected %d operations, got %d: %v", test.operations, len(operations), operations)
+			}
+			assertPod(t, expected, apply(t, pod, operations))
+		})
+	}
+
+	if operations := UpdateMap(nil, nil, "/metadata/labels"); operations != nil {
+		t.Errorf("expected no operations when nothing is added, got %v", operations)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	original := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test",
+			Labels:      map[string]string{"app": "web", "a/b~c": "old"},
+			Annotations: map[string]string{"removed": "value"},
+		},
+		Spec: corev1.PodSpec{Containers: containers("app")},
+	}
+
+	modified := original.DeepCopy()
+	modified.Labels["a/b~c"] = "new"
+	modified.Labels["added"] = "value"
+	modified.Annotations = nil
+	modified.Spec.Containers = containers("app", "sidecar")
+	modified.Spec.Tolerations = []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+
+	toValue := func(pod *corev1.Pod) any {
+		data, err := json.Marshal(pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var value any
+		if err := json.Unmarshal(data, &value); err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	assertPod(t, modified, apply(t, original, Diff(toValue(original), toValue(modified))))
+
+	if operations := Diff(toValue(original), toValue(original.DeepCopy())); operations != nil {
+		t.Errorf("expected no operations for identical values, got %v", operations)
+	}
+}
@@ -11,13 +11,14 @@ type HealthController interface {
 	Health(http.ResponseWriter, *http.Request)
 }
 
-/*NewHealthController is a factory method to create an instance of HealthController*/
-func NewHealthController(logger *zap.Logger) (HealthController, error) {
-	return healthController{logger: logger}, nil
+/*NewHealthController is a factory method to create an instance of HealthController, status is optional*/
+func NewHealthController(logger *zap.Logger, status func() string) (HealthController, error) {
+	return healthController{logger: logger, status: status}, nil
 }
 
 type healthController struct {
 	logger *zap.Logger
+	status func() string
 }
 
 func (controller healthController) Health(writer http.ResponseWriter, request *http.Request) {
@@ -25,7 +26,12 @@ func (controller healthController) Health(writer http.ResponseWriter, request *h
 		defer request.Body.Close()
 	}
 
-	if _, err := writer.Write([]byte("Healthy")); err != nil {
+	response := "Healthy"
+	if controller.status != nil {
+		response += "\n" + controller.status()
+	}
+
+	if _, err := writer.Write([]byte(response)); err != nil {
 		writeError(writer, controller.logger, "Failed to write response", err, http.StatusInternalServerError)
 	}
 }
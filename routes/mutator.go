@@ -10,10 +10,12 @@ import (
 	"go.uber.org/zap"
 )
 
-/*MutatorController is an interface that implements mutation method*/
+/*MutatorController is an interface that implements mutation and validation methods*/
 type MutatorController interface {
 	Shutdown()
+	Status() string
 	Mutate(http.ResponseWriter, *http.Request)
+	Validate(http.ResponseWriter, *http.Request)
 }
 
 /*NewMutatorController is a factory method to create an instance of MutatorController*/
@@ -33,14 +35,26 @@ func (controller mutatorController) Shutdown() {
 	controller.mutator.Shutdown()
 }
 
+func (controller mutatorController) Status() string {
+	return controller.mutator.NativeSidecarStatus()
+}
+
 func (controller mutatorController) Mutate(writer http.ResponseWriter, request *http.Request) {
+	controller.handleReview(writer, request, controller.mutator.Mutate)
+}
+
+func (controller mutatorController) Validate(writer http.ResponseWriter, request *http.Request) {
+	controller.handleReview(writer, request, controller.mutator.Validate)
+}
+
+func (controller mutatorController) handleReview(writer http.ResponseWriter, request *http.Request, review func([]byte) ([]byte, error)) {
 	body, err := controller.readRequestBody(request)
 	if err != nil {
 		writeError(writer, controller.mutator.Logger, "Bad request", err, http.StatusBadRequest)
 		return
 	}
 
-	resp, err := controller.mutator.Mutate(body)
+	resp, err := review(body)
 	if err != nil {
 		writeError(writer, controller.mutator.Logger, "Failed to process request", err, http.StatusInternalServerError)
 		return
@@ -73,7 +87,7 @@ func (controller mutatorController) readRequestBody(r *http.Request) ([]byte, er
 		return nil, fmt.Errorf("received Content-Type=%s, Expected Content-Type is 'application/json'", contentType)
 	}
 
-	controller.mutator.Logger.Debug("Request received", 
+	controller.mutator.Logger.Debug("Request received",
 		zap.ByteString("body", body))
 	return body, nil
 }
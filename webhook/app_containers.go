@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/CenterEdge/shawarma-webhook/patch"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// appContainerChanges collects environment variables and volume mounts to add to the pod's existing containers,
+// keyed by the index of the container in the pod
+type appContainerChanges struct {
+	env          map[int][]corev1.EnvVar
+	volumeMounts map[int][]corev1.VolumeMount
+}
+
+func newAppContainerChanges() *appContainerChanges {
+	return &appContainerChanges{
+		env:          make(map[int][]corev1.EnvVar),
+		volumeMounts: make(map[int][]corev1.VolumeMount),
+	}
+}
+
+// getInjectedContainerNames returns the names of the pod's containers which were added by previously injected sidecar
+// templates, these aren't application containers
+func getInjectedContainerNames(pod *corev1.Pod, sideCarNames []string, sideCarConfig *SideCarConfig) sets.Set[string] {
+	names := sets.New[string]()
+	for _, name := range sideCarNames {
+		sideCarSrc, ok := sideCarConfig.SideCars[name]
+		if !ok || !isInjected(pod, name) {
+			continue
+		}
+
+		for _, container := range sideCarSrc.Sidecar.Containers {
+			if hasContainer(pod, container.Name) {
+				names.Insert(container.Name)
+			}
+		}
+	}
+	return names
+}
+
+// add merges the sidecar's app container environment variables and volume mounts into the selected pod containers,
+// excluding containers added by previously injected templates. Items which are already present and identical are
+// skipped. Conflicting items, with the same environment variable name or mount path but a different definition, fail
+// unless the sidecar's collision strategy is skip or rename, in which case the pod's definition is kept.
+func (changes *appContainerChanges) add(pod *corev1.Pod, named *NamedSideCar, sideCar *SideCar, injectedContainers sets.Set[string], logger *zap.Logger) error {
+	if len(sideCar.AppContainerEnv) == 0 && len(sideCar.AppContainerVolumeMounts) == 0 {
+		return nil
+	}
+
+	strategy := named.CollisionStrategy
+	if strategy == "" {
+		strategy = CollisionFail
+	}
+
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if injectedContainers.Has(container.Name) {
+			continue
+		}
+		if len(sideCar.AppContainerNames) > 0 && !slices.Contains(sideCar.AppContainerNames, container.Name) {
+			continue
+		}
+
+		for _, env := range sideCar.AppContainerEnv {
+			existing := slices.IndexFunc(container.Env, func(e corev1.EnvVar) bool { return e.Name == env.Name })
+			if existing >= 0 && equality.Semantic.DeepEqual(container.Env[existing], env) {
+				continue
+			}
+
+			pending := slices.IndexFunc(changes.env[i], func(e corev1.EnvVar) bool { return e.Name == env.Name })
+			if pending >= 0 && equality.Semantic.DeepEqual(changes.env[i][pending], env) {
+				continue
+			}
+
+			if existing >= 0 || pending >= 0 {
+				if strategy == CollisionFail {
+					return fmt.Errorf("sidecar %s environment variable %s conflicts with an existing variable in container %s", named.Name, env.Name, container.Name)
+				}
+
+				logger.Info("Skipping environment variable which conflicts with the container",
+					zap.String("sidecar", named.Name),
+					zap.String("container", container.Name),
+					zap.String("env", env.Name))
+				continue
+			}
+
+			changes.env[i] = append(changes.env[i], env)
+		}
+
+		for _, mount := range sideCar.AppContainerVolumeMounts {
+			isSamePath := func(m corev1.VolumeMount) bool { return m.MountPath == mount.MountPath }
+
+			existing := slices.IndexFunc(container.VolumeMounts, isSamePath)
+			if existing >= 0 && equality.Semantic.DeepEqual(container.VolumeMounts[existing], mount) {
+				continue
+			}
+
+			pending := slices.IndexFunc(changes.volumeMounts[i], isSamePath)
+			if pending >= 0 && equality.Semantic.DeepEqual(changes.volumeMounts[i][pending], mount) {
+				continue
+			}
+
+			if existing >= 0 || pending >= 0 {
+				if strategy == CollisionFail {
+					return fmt.Errorf("sidecar %s volume mount %s conflicts with an existing mount in container %s", named.Name, mount.MountPath, container.Name)
+				}
+
+				logger.Info("Skipping volume mount which conflicts with the container",
+					zap.String("sidecar", named.Name),
+					zap.String("container", container.Name),
+					zap.String("mountPath", mount.MountPath))
+				continue
+			}
+
+			changes.volumeMounts[i] = append(changes.volumeMounts[i], mount)
+		}
+	}
+
+	return nil
+}
+
+// createPatch returns the patch operations to apply the changes, in container order
+func (changes *appContainerChanges) createPatch(pod *corev1.Pod) []patch.Operation {
+	var operations []patch.Operation
+	for i := range pod.Spec.Containers {
+		basePath := patch.Path("/spec/containers", strconv.Itoa(i))
+		operations = append(operations, patch.AppendToList(pod.Spec.Containers[i].Env, changes.env[i], basePath+"/env")...)
+		operations = append(operations, patch.AppendToList(pod.Spec.Containers[i].VolumeMounts, changes.volumeMounts[i], basePath+"/volumeMounts")...)
+	}
+	return operations
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAppContainersReinvocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name: "all containers",
+			config: `
+sidecars:
+- name: shawarma
+  sidecar:
+    containers:
+    - name: shawarma
+      image: "|SHAWARMA_IMAGE|"
+    appContainerEnv:
+    - name: SHAWARMA_URL
+      value: http://localhost:8099
+`,
+		},
+		{
+			name: "sidecar sets the same variable",
+			config: `
+sidecars:
+- name: shawarma
+  sidecar:
+    containers:
+    - name: shawarma
+      image: "|SHAWARMA_IMAGE|"
+      env:
+      - name: SHAWARMA_URL
+        value: http://localhost:8080/applicationstate
+    appContainerEnv:
+    - name: SHAWARMA_URL
+      value: http://localhost:8099
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mutator := newTestMutator(t, test.config)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Annotations: map[string]string{sideCarInjectionAnnotation: "test"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "app"}},
+				},
+			}
+
+			injected, patchBytes := mutatePod(t, mutator, pod)
+			if patchBytes == nil {
+				t.Fatal("expected a patch on the first pass")
+			}
+
+			if len(injected.Spec.Containers) != 2 {
+				t.Fatalf("expected 2 containers, got %d", len(injected.Spec.Containers))
+			}
+			if env := injected.Spec.Containers[0].Env; len(env) != 1 || env[0].Value != "http://localhost:8099" {
+				t.Errorf("expected the app container env to be added, got %v", env)
+			}
+			if env := injected.Spec.Containers[1].Env; len(env) > 1 || (len(env) == 1 && env[0].Value != "http://localhost:8080/applicationstate") {
+				t.Errorf("expected the sidecar container env to be unchanged, got %v", env)
+			}
+
+			if _, patchBytes := mutatePod(t, mutator, injected); patchBytes != nil {
+				t.Errorf("expected no patch on the second pass, got %s", patchBytes)
+			}
+		})
+	}
+}
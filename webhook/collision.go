@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/*CollisionStrategy determines how a sidecar container or volume is handled if the name is already used by the pod*/
+type CollisionStrategy string
+
+const (
+	// CollisionFail rejects the pod with a descriptive error
+	CollisionFail CollisionStrategy = "fail"
+	// CollisionSkip leaves the existing item in place and doesn't add the sidecar's item
+	CollisionSkip CollisionStrategy = "skip"
+	// CollisionRename adds a suffix to the name of the sidecar's item, updating volume mounts to match
+	CollisionRename CollisionStrategy = "rename"
+)
+
+func validateCollisionStrategy(strategy CollisionStrategy) error {
+	switch strategy {
+	case "", CollisionFail, CollisionSkip, CollisionRename:
+		return nil
+	default:
+		return fmt.Errorf("invalid collision strategy %q, must be fail, skip, or rename", strategy)
+	}
+}
+
+// podNames tracks the container and volume names used by a pod as sidecars are added
+type podNames struct {
+	containers map[string]bool
+	volumes    map[string]bool
+}
+
+func newPodNames(pod *corev1.Pod) *podNames {
+	names := &podNames{
+		containers: make(map[string]bool),
+		volumes:    make(map[string]bool),
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		names.containers[container.Name] = true
+	}
+	for _, container := range pod.Spec.Containers {
+		names.containers[container.Name] = true
+	}
+	for _, volume := range pod.Spec.Volumes {
+		names.volumes[volume.Name] = true
+	}
+
+	return names
+}
+
+// isInjected returns true if the pod records that the named sidecar was previously injected
+func isInjected(pod *corev1.Pod, name string) bool {
+	injectedList, ok := pod.Annotations[sideCarInjectedListAnnotation]
+	if !ok {
+		// Pods injected before the list was recorded only have the status annotation
+		return pod.Annotations[sideCarInjectionStatusAnnotation] == injectedValue
+	}
+
+	return slices.Contains(parseSideCarNames(injectedList), name)
+}
+
+// resolveCollisions removes or renames containers and volumes in the sidecar which have the same name as a
+// container or volume in the pod. Items which are already present because the sidecar was previously injected
+// are removed. Otherwise the named sidecar's collision strategy is applied. Volumes already added by another
+// sidecar in the same request are shared and also removed. Names are reserved as they are accepted.
+func resolveCollisions(pod *corev1.Pod, named *NamedSideCar, sideCar *SideCar, names *podNames, addedVolumes []corev1.Volume, logger *zap.Logger) error {
+	injected := isInjected(pod, named.Name)
+	strategy := named.CollisionStrategy
+	if strategy == "" {
+		strategy = CollisionFail
+	}
+	suffix := named.RenameSuffix
+	if suffix == "" {
+		suffix = "-" + named.Name
+	}
+
+	var volumes []corev1.Volume
+	for _, volume := range sideCar.Volumes {
+		if slices.ContainsFunc(addedVolumes, func(v corev1.Volume) bool { return v.Name == volume.Name }) {
+			// Templates injected together may share volumes, only add the first of each name
+			continue
+		}
+
+		if names.volumes[volume.Name] {
+			if injected {
+				logger.Debug("Volume already injected",
+					zap.String("sidecar", named.Name),
+					zap.String("volume", volume.Name))
+				continue
+			}
+
+			switch strategy {
+			case CollisionSkip:
+				logger.Info("Skipping sidecar volume which conflicts with the pod",
+					zap.String("sidecar", named.Name),
+					zap.String("volume", volume.Name))
+				continue
+			case CollisionRename:
+				newName := volume.Name + suffix
+				if names.volumes[newName] {
+					return fmt.Errorf("sidecar %s volume %s conflicts with the pod, and the renamed volume %s also conflicts", named.Name, volume.Name, newName)
+				}
+
+				logger.Info("Renaming sidecar volume which conflicts with the pod",
+					zap.String("sidecar", named.Name),
+					zap.String("volume", volume.Name),
+					zap.String("newName", newName))
+
+				sideCar.renameVolume(volume.Name, newName)
+				volume.Name = newName
+			default:
+				return fmt.Errorf("sidecar %s volume %s conflicts with an existing volume in the pod", named.Name, volume.Name)
+			}
+		}
+
+		names.volumes[volume.Name] = true
+		volumes = append(volumes, volume)
+	}
+	sideCar.Volumes = volumes
+
+	containers, err := resolveContainerCollisions(pod, named, sideCar.Containers, names, injected, strategy, suffix, logger)
+	if err != nil {
+		return err
+	}
+	sideCar.Containers = containers
+
+	initContainers, err := resolveContainerCollisions(pod, named, sideCar.InitContainers, names, injected, strategy, suffix, logger)
+	if err != nil {
+		return err
+	}
+	sideCar.InitContainers = initContainers
+
+	return nil
+}
+
+// resolveContainerCollisions applies the collision strategy to a list of the sidecar's containers or init containers,
+// which share a single set of names within the pod
+func resolveContainerCollisions(pod *corev1.Pod, named *NamedSideCar, source []corev1.Container, names *podNames, injected bool, strategy CollisionStrategy, suffix string, logger *zap.Logger) ([]corev1.Container, error) {
+	var containers []corev1.Container
+	for _, container := range source {
+		if names.containers[container.Name] {
+			if injected && hasContainer(pod, container.Name) {
+				logger.Debug("Container already injected",
+					zap.String("sidecar", named.Name),
+					zap.String("container", container.Name))
+				continue
+			}
+
+			switch strategy {
+			case CollisionSkip:
+				logger.Info("Skipping sidecar container which conflicts with the pod",
+					zap.String("sidecar", named.Name),
+					zap.String("container", container.Name))
+				continue
+			case CollisionRename:
+				newName := container.Name + suffix
+				if names.containers[newName] {
+					return nil, fmt.Errorf("sidecar %s container %s conflicts with the pod, and the renamed container %s also conflicts", named.Name, container.Name, newName)
+				}
+
+				logger.Info("Renaming sidecar container which conflicts with the pod",
+					zap.String("sidecar", named.Name),
+					zap.String("container", container.Name),
+					zap.String("newName", newName))
+
+				container.Name = newName
+			default:
+				return nil, fmt.Errorf("sidecar %s container %s conflicts with an existing container in the pod", named.Name, container.Name)
+			}
+		}
+
+		names.containers[container.Name] = true
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
+
+// renameVolume updates the sidecar's volume mounts which reference a renamed volume
+func (in *SideCar) renameVolume(oldName string, newName string) {
+	for i := range in.Containers {
+		container := &in.Containers[i]
+		for j := range container.VolumeMounts {
+			if container.VolumeMounts[j].Name == oldName {
+				container.VolumeMounts[j].Name = newName
+			}
+		}
+	}
+
+	for i := range in.InitContainers {
+		container := &in.InitContainers[i]
+		for j := range container.VolumeMounts {
+			if container.VolumeMounts[j].Name == oldName {
+				container.VolumeMounts[j].Name = newName
+			}
+		}
+	}
+
+	for i := range in.AppContainerVolumeMounts {
+		if in.AppContainerVolumeMounts[i].Name == oldName {
+			in.AppContainerVolumeMounts[i].Name = newName
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/CenterEdge/shawarma-webhook/filewatcher"
+	"go.uber.org/zap"
+)
+
+/*fileMonitor watches a file and sends the parsed contents to the output channel each time it changes*/
+type fileMonitor[T any] struct {
+	filePath    string
+	description string
+	load        func(filePath string, logger *zap.Logger) (T, error)
+	empty       func() T
+	loaded      atomic.Bool
+	output      chan T
+	logger      *zap.Logger
+	watcher     filewatcher.FileWatcher
+}
+
+// newFileMonitor creates a monitor which parses the file using load. If the file is invalid when first loaded the result
+// of empty is sent instead, later invalid versions are logged and the previous contents remain in use.
+func newFileMonitor[T any](filePath, description string, load func(string, *zap.Logger) (T, error), empty func() T, logger *zap.Logger) (*fileMonitor[T], error) {
+	if filePath == "" {
+		return nil, fmt.Errorf("filePath is required")
+	}
+	if logger == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+
+	monitor := &fileMonitor[T]{
+		filePath:    filePath,
+		description: description,
+		load:        load,
+		empty:       empty,
+		output:      make(chan T),
+		logger:      logger,
+	}
+
+	return monitor, nil
+}
+
+func (monitor *fileMonitor[T]) Start() error {
+	watcher, err := filewatcher.NewFileWatcher(monitor.filePath, func() {
+		monitor.logger.Debug("File changed",
+			zap.String("file", monitor.filePath))
+
+		monitor.processFile()
+	}, monitor.logger)
+	if err != nil {
+		return err
+	}
+
+	monitor.watcher = watcher
+
+	// Perform initial load
+	monitor.processFile()
+
+	return nil
+}
+
+func (monitor *fileMonitor[T]) GetOutput() <-chan T {
+	return monitor.output
+}
+
+func (monitor *fileMonitor[T]) Shutdown() {
+	if monitor.watcher != nil {
+		monitor.watcher.Close()
+		monitor.watcher = nil
+
+		close(monitor.output)
+	}
+}
+
+func (monitor *fileMonitor[T]) processFile() {
+	data, err := monitor.load(monitor.filePath, monitor.logger)
+	if err == nil {
+		monitor.loaded.Store(true)
+		monitor.output <- data
+		return
+	}
+
+	if monitor.loaded.Load() {
+		monitor.logger.Error("Invalid "+monitor.description+" file, keeping the previous version",
+			zap.String("file", monitor.filePath),
+			zap.Error(err))
+		return
+	}
+
+	monitor.logger.Error("Invalid "+monitor.description+" file",
+		zap.String("file", monitor.filePath),
+		zap.Error(err))
+
+	monitor.output <- monitor.empty()
+}
@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestImageLockMonitorReload(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	lockFile := filepath.Join(t.TempDir(), "images.yaml")
+	writeLock := func(contents string) {
+		t.Helper()
+		if err := os.WriteFile(lockFile, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	monitor, err := NewImageLockMonitor(lockFile, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []*ImageLock
+	done := make(chan struct{})
+	go func() {
+		for imageLock := range monitor.GetOutput() {
+			received = append(received, imageLock)
+		}
+		close(done)
+	}()
+
+	// Each load completes once the consumer has received any output
+	writeLock("images: [")
+	monitor.processFile()
+	writeLock("images:\n  centeredge/shawarma:2.0.0: centeredge/shawarma@" + digest + "\n")
+	monitor.processFile()
+	writeLock("images: [")
+	monitor.processFile()
+
+	close(monitor.output)
+	<-done
+
+	if len(received) != 2 {
+		t.Fatalf("expected an empty lock and a loaded lock, got %d locks", len(received))
+	}
+	if len(received[0].images) != 0 {
+		t.Errorf("expected an empty lock when the initial file is invalid, got %v", received[0].images)
+	}
+	if len(received[1].images) != 1 {
+		t.Errorf("expected the valid lock to be loaded, got %v", received[1].images)
+	}
+}
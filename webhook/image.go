@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	defaultRegistry        = "docker.io"
+	defaultRepositoryGroup = "library"
+)
+
+var (
+	repositoryRegex = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRegex        = regexp.MustCompile(`^\w[\w.-]{0,127}$`)
+	digestRegex     = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+)
+
+// imageReference is a parsed container image reference, such as docker.io/centeredge/shawarma:2.0.0
+type imageReference struct {
+	// Registry is the registry host, docker.io if not specified
+	Registry string
+	// Repository is the path of the image within the registry, images on docker.io without a path are in library
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseImageReference parses and normalizes an image reference using the same defaults as the container runtime
+func parseImageReference(image string) (*imageReference, error) {
+	remainder := strings.TrimSpace(image)
+	if remainder == "" {
+		return nil, fmt.Errorf("image reference is empty")
+	}
+
+	reference := &imageReference{}
+
+	if index := strings.Index(remainder, "@"); index >= 0 {
+		reference.Digest = remainder[index+1:]
+		remainder = remainder[:index]
+		if !digestRegex.MatchString(reference.Digest) {
+			return nil, fmt.Errorf("invalid digest in image reference %q", image)
+		}
+	}
+
+	if index := strings.LastIndex(remainder, ":"); index >= 0 && !strings.Contains(remainder[index+1:], "/") {
+		reference.Tag = remainder[index+1:]
+		remainder = remainder[:index]
+		if !tagRegex.MatchString(reference.Tag) {
+			return nil, fmt.Errorf("invalid tag in image reference %q", image)
+		}
+	}
+
+	// The first component is a registry if it looks like a host name
+	if index := strings.Index(remainder, "/"); index >= 0 {
+		host := remainder[:index]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			reference.Registry = host
+			remainder = remainder[index+1:]
+		}
+	}
+
+	if reference.Registry == "" {
+		reference.Registry = defaultRegistry
+	}
+	if reference.Registry == defaultRegistry && !strings.Contains(remainder, "/") {
+		remainder = defaultRepositoryGroup + "/" + remainder
+	}
+
+	if !repositoryRegex.MatchString(remainder) {
+		return nil, fmt.Errorf("invalid repository in image reference %q", image)
+	}
+	reference.Repository = remainder
+
+	return reference, nil
+}
+
+// Name returns the fully qualified repository name, without the tag or digest
+func (reference *imageReference) Name() string {
+	return reference.Registry + "/" + reference.Repository
+}
+
+// String returns the fully qualified image reference
+func (reference *imageReference) String() string {
+	image := reference.Name()
+	if reference.Tag != "" {
+		image += ":" + reference.Tag
+	}
+	if reference.Digest != "" {
+		image += "@" + reference.Digest
+	}
+	return image
+}
+
+// rewriteImages replaces the image of each of the sidecar's containers and init containers
+func (in *SideCar) rewriteImages(rewrite func(image string) (string, error)) error {
+	for _, containers := range [][]corev1.Container{in.Containers, in.InitContainers} {
+		for i := range containers {
+			image, err := rewrite(containers[i].Image)
+			if err != nil {
+				return fmt.Errorf("container %s: %w", containers[i].Name, err)
+			}
+			containers[i].Image = image
+		}
+	}
+
+	return nil
+}
+
+// resolveImage pins an injected image to its digest using the image lock, if any, then applies the registry mirrors
+func (mutator *Mutator) resolveImage(image string, sideCarConfig *SideCarConfig, imageLock *ImageLock, logger *zap.Logger) (string, error) {
+	if imageLock != nil {
+		pinned, ok, err := imageLock.pin(image)
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			if mutator.imageLockStrict {
+				return "", fmt.Errorf("image %s is not pinned in the image lock file", image)
+			}
+
+			logger.Debug("Image is not pinned in the image lock file",
+				zap.String("image", image))
+		} else if pinned != image {
+			logger.Debug("Pinning image to digest",
+				zap.String("image", image),
+				zap.String("pinned", pinned))
+		}
+
+		image = pinned
+	}
+
+	mirrored, ok, err := sideCarConfig.registryMirrors.rewrite(image)
+	if err != nil {
+		return "", err
+	}
+
+	if ok {
+		logger.Debug("Rewriting image to registry mirror",
+			zap.String("image", image),
+			zap.String("mirror", mirrored))
+	}
+
+	return mirrored, nil
+}
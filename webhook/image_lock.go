@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+)
+
+/*imageLockContents is the format of the image lock file*/
+type imageLockContents struct {
+	Images map[string]string `json:"images"`
+}
+
+/*ImageLock maps image tags to images pinned by digest*/
+type ImageLock struct {
+	// Pinned images keyed by the normalized image name and tag
+	images map[string]string
+}
+
+func LoadImageLock(imageLockFile string, logger *zap.Logger) (*ImageLock, error) {
+	data, err := os.ReadFile(imageLockFile)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("New image lock file",
+		zap.ByteString("data", data))
+
+	var file imageLockContents
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	lock := &ImageLock{images: make(map[string]string, len(file.Images))}
+	for image, pinned := range file.Images {
+		reference, err := parseImageReference(image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image lock entry %s: %w", image, err)
+		}
+		if reference.Digest != "" {
+			return nil, fmt.Errorf("invalid image lock entry %s, the image must not include a digest", image)
+		}
+
+		pinnedReference, err := parseImageReference(pinned)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image lock entry %s: %w", image, err)
+		}
+		if pinnedReference.Digest == "" {
+			return nil, fmt.Errorf("invalid image lock entry %s, the pinned image %s must include a digest", image, pinned)
+		}
+		if pinnedReference.Name() != reference.Name() {
+			return nil, fmt.Errorf("invalid image lock entry %s, the pinned image %s must be the same repository", image, pinned)
+		}
+
+		lock.images[imageLockKey(reference)] = pinnedReference.String()
+	}
+
+	return lock, nil
+}
+
+// imageLockKey returns the normalized name and tag of the image, images without a tag use latest
+func imageLockKey(reference *imageReference) string {
+	tag := reference.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return reference.Name() + ":" + tag
+}
+
+// pin returns the image pinned by digest. Returns false if the image isn't in the lock file, images which already
+// include a digest are returned unchanged as pinned.
+func (lock *ImageLock) pin(image string) (string, bool, error) {
+	reference, err := parseImageReference(image)
+	if err != nil {
+		return image, false, err
+	}
+
+	if reference.Digest != "" {
+		return image, true, nil
+	}
+
+	pinned, ok := lock.images[imageLockKey(reference)]
+	if !ok {
+		return image, false, nil
+	}
+	return pinned, true, nil
+}
@@ -0,0 +1,20 @@
+package webhook
+
+import (
+	"go.uber.org/zap"
+)
+
+type ImageLockMonitor struct {
+	*fileMonitor[*ImageLock]
+}
+
+func NewImageLockMonitor(filePath string, logger *zap.Logger) (*ImageLockMonitor, error) {
+	monitor, err := newFileMonitor(filePath, "image lock", LoadImageLock, func() *ImageLock {
+		return &ImageLock{images: make(map[string]string)}
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImageLockMonitor{monitor}, nil
+}
@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"fmt"
+)
+
+/*ImageOverridePolicy restricts the images which may be selected using the image annotation*/
+type ImageOverridePolicy struct {
+	// Disabled rejects all pods which use the image annotation
+	Disabled     bool     `json:"disabled,omitempty"`
+	Registries   []string `json:"registries,omitempty"`
+	Repositories []string `json:"repositories,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+
+	registries   *patternMatcher
+	repositories *patternMatcher
+	tags         *patternMatcher
+}
+
+func (policy *ImageOverridePolicy) compile() error {
+	if policy == nil {
+		return nil
+	}
+
+	var err error
+	if policy.registries, err = newPatternMatcher(policy.Registries); err != nil {
+		return fmt.Errorf("invalid image override registries: %w", err)
+	}
+	if policy.repositories, err = newPatternMatcher(policy.Repositories); err != nil {
+		return fmt.Errorf("invalid image override repositories: %w", err)
+	}
+	if policy.tags, err = newPatternMatcher(policy.Tags); err != nil {
+		return fmt.Errorf("invalid image override tags: %w", err)
+	}
+
+	return nil
+}
+
+// check returns an error if the image may not be used as an override. Each list which isn't empty must match the image,
+// repositories may match either the repository path or the full name including the registry. Images without a tag or
+// digest are matched using the tag latest. A nil policy allows any image.
+func (policy *ImageOverridePolicy) check(image string) error {
+	if policy == nil {
+		return nil
+	}
+
+	if policy.Disabled {
+		return fmt.Errorf("image override %q is not allowed, image overrides are disabled", image)
+	}
+
+	reference, err := parseImageReference(image)
+	if err != nil {
+		return fmt.Errorf("image override is not allowed: %w", err)
+	}
+
+	if !policy.registries.isEmpty() {
+		if _, ok := policy.registries.match(reference.Registry); !ok {
+			return fmt.Errorf("image override %q is not allowed, registry %s is not in the allowed registries", image, reference.Registry)
+		}
+	}
+
+	if !policy.repositories.isEmpty() {
+		_, ok := policy.repositories.match(reference.Repository)
+		if !ok {
+			_, ok = policy.repositories.match(reference.Name())
+		}
+		if !ok {
+			return fmt.Errorf("image override %q is not allowed, repository %s is not in the allowed repositories", image, reference.Name())
+		}
+	}
+
+	if !policy.tags.isEmpty() {
+		tag := reference.Tag
+		if tag == "" && reference.Digest == "" {
+			tag = "latest"
+		}
+
+		// Digests are immutable, so an image pinned by digest without a tag is allowed from an allowed repository
+		if tag != "" {
+			if _, ok := policy.tags.match(tag); !ok {
+				return fmt.Errorf("image override %q is not allowed, tag %s is not in the allowed tags", image, tag)
+			}
+		}
+	}
+
+	return nil
+}
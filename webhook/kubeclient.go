@@ -0,0 +1,32 @@
+package webhook
+
+import (
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	k8sClient *kubernetes.Clientset
+)
+
+// InitializeKubernetesClient with the in-cluster Kubernetes configuration
+func InitializeKubernetesClient() error {
+	if k8sClient != nil {
+		return nil
+	}
+
+	// creates the in-cluster config
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	k8sClient = clientset
+
+	return nil
+}
@@ -3,15 +3,21 @@ package webhook
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/CenterEdge/shawarma-webhook/patch"
 	"go.uber.org/zap"
 	v1 "k8s.io/api/admission/v1"
 	"k8s.io/api/admission/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
@@ -20,10 +26,12 @@ import (
 )
 
 var (
-	runtimeScheme    = runtime.NewScheme()
-	codecs           = serializer.NewCodecFactory(runtimeScheme)
-	deserializer     = codecs.UniversalDeserializer()
-	systemNameSpaces = []string{
+	runtimeScheme = runtime.NewScheme()
+	codecs        = serializer.NewCodecFactory(runtimeScheme)
+	deserializer  = codecs.UniversalDeserializer()
+
+	// SystemNameSpaces are ignored by default
+	SystemNameSpaces = []string{
 		metav1.NamespaceSystem,
 		metav1.NamespacePublic,
 	}
@@ -33,12 +41,36 @@ const (
 	sideCarNameSpace                 = "shawarma.centeredge.io/"
 	injectAnnotation                 = "service-name"
 	labelInjectAnnotation            = "service-labels"
+	injectOverrideAnnotation         = "inject"
 	imageAnnotation                  = "image"
+	sideCarAnnotation                = "sidecar"
 	statusAnnotation                 = "status"
+	injectedSideCarsAnnotation       = "injected-sidecars"
+	nativeSideCarAnnotation          = "native-sidecar"
+	sideCarModeAnnotation            = "sidecar-mode"
+	cpuRequestAnnotation             = "cpu-request"
+	cpuLimitAnnotation               = "cpu-limit"
+	memoryRequestAnnotation          = "memory-request"
+	memoryLimitAnnotation            = "memory-limit"
+	logLevelAnnotation               = "log-level"
+	stateURLAnnotation               = "state-url"
+	listenPortAnnotation             = "listen-port"
 	sideCarInjectionAnnotation       = sideCarNameSpace + injectAnnotation
 	sideCarLabelInjectionAnnotation  = sideCarNameSpace + labelInjectAnnotation
+	sideCarInjectAnnotation          = sideCarNameSpace + injectOverrideAnnotation
 	sideCarInjectionStatusAnnotation = sideCarNameSpace + statusAnnotation
 	sideCarInjectionImageAnnotation  = sideCarNameSpace + imageAnnotation
+	sideCarSelectionAnnotation       = sideCarNameSpace + sideCarAnnotation
+	sideCarInjectedListAnnotation    = sideCarNameSpace + injectedSideCarsAnnotation
+	sideCarNativeAnnotation          = sideCarNameSpace + nativeSideCarAnnotation
+	sideCarModeStatusAnnotation      = sideCarNameSpace + sideCarModeAnnotation
+	sideCarCPURequestAnnotation      = sideCarNameSpace + cpuRequestAnnotation
+	sideCarCPULimitAnnotation        = sideCarNameSpace + cpuLimitAnnotation
+	sideCarMemoryRequestAnnotation   = sideCarNameSpace + memoryRequestAnnotation
+	sideCarMemoryLimitAnnotation     = sideCarNameSpace + memoryLimitAnnotation
+	sideCarLogLevelAnnotation        = sideCarNameSpace + logLevelAnnotation
+	sideCarStateURLAnnotation        = sideCarNameSpace + stateURLAnnotation
+	sideCarListenPortAnnotation      = sideCarNameSpace + listenPortAnnotation
 	injectedValue                    = "injected"
 	sideCarName                      = "shawarma"
 	sideCarWithTokenName             = "shawarma-withtoken"
@@ -49,30 +81,74 @@ type unversionedAdmissionReview struct {
 	v1.AdmissionReview
 }
 
-type patchOperation struct {
-	Op    string      `json:"op"`
-	Path  string      `json:"path"`
-	Value any         `json:"value,omitempty"`
+// injection describes the sidecars selected for a pod and why
+type injection struct {
+	sideCarNames []string
+	rule         string
+	// Additional annotations to add to the pod
+	annotations map[string]string
+	// Sidecars which must be injected as native sidecars, regardless of the default
+	forceNative map[string]bool
+	// Overrides the default native sidecar mode for this pod, if set
+	nativeOverride *bool
+	// Warnings returned to the client in the admission response
+	warnings []string
+}
+
+// nativeEnabled returns true if sidecars should be injected as native sidecars by default for this pod
+func (injection *injection) nativeEnabled(mutator *Mutator) bool {
+	if injection.nativeOverride != nil {
+		return *injection.nativeOverride
+	}
+
+	return mutator.nativeSidecarsEnabled()
+}
+
+// isNative returns true if the named sidecar should be injected as a native sidecar
+func (injection *injection) isNative(name string, mutator *Mutator) bool {
+	return injection.nativeEnabled(mutator) || injection.forceNative[name]
 }
 
 type MutatorConfig struct {
-	SideCarConfigFile       string
-	ShawarmaImage           string
-	NativeSidecars      	bool
-	ShawarmaServiceAcctName string
-	ShawarmaSecretTokenName string
-	Logger					*zap.Logger
+	SideCarConfigFile          string
+	ShawarmaImage              string
+	NativeSidecars             NativeSidecarMode
+	NativeSidecarCheckInterval time.Duration
+	ImageLockFile              string
+	ImageLockStrict            bool
+	VerifyFailOpen             bool
+	ServiceCheck               ServiceCheckMode
+	NamespaceSelectors         bool
+	ShawarmaServiceAcctName    string
+	ShawarmaSecretTokenName    string
+	DefaultSideCar             string
+	Tokens                     map[string]string
+	IgnoreNamespaces           []string
+	OnlyNamespaces             []string
+	Logger                     *zap.Logger
 }
 
 /*Mutator is the interface for mutating webhook*/
 type Mutator struct {
-	sideCars                atomic.Value
-	sideCarMonitor          *SideCarMonitor
+	sideCarConfig    atomic.Value
+	sideCarMonitor   *SideCarMonitor
+	imageLock        atomic.Value
+	imageLockMonitor *ImageLockMonitor
+	imageLockStrict  bool
+	verifyFailOpen   bool
+	serviceCheckMode ServiceCheckMode
+	serviceMonitor   *ServiceMonitor
+	namespaceMonitor *NamespaceMonitor
 
 	shawarmaImage           string
-	nativeSidecars          bool
+	nativeSidecarMode       NativeSidecarMode
+	nativeSidecarDetector   *NativeSidecarDetector
 	shawarmaServiceAcctName string
 	shawarmaSecretTokenName string
+	defaultSideCar          string
+	tokens                  map[string]string
+	ignoreNamespaces        *patternMatcher
+	onlyNamespaces          *patternMatcher
 	serviceAcctMonitors     *ServiceAcctMonitorSet
 	Logger                  *zap.Logger
 }
@@ -96,25 +172,85 @@ func NewMutator(config *MutatorConfig) (*Mutator, error) {
 		return nil, fmt.Errorf("config.Logger is required")
 	}
 
+	ignoredList := config.IgnoreNamespaces
+	if ignoredList == nil {
+		ignoredList = SystemNameSpaces
+	}
+	ignoreNamespaces, err := newPatternMatcher(ignoredList)
+	if err != nil {
+		return nil, err
+	}
+
+	onlyNamespaces, err := newPatternMatcher(config.OnlyNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	var nativeSidecarDetector *NativeSidecarDetector
+	switch config.NativeSidecars {
+	case NativeSidecarsEnabled, NativeSidecarsDisabled, "":
+	case NativeSidecarsAuto:
+		nativeSidecarDetector, err = NewNativeSidecarDetector(config.NativeSidecarCheckInterval, config.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create native sidecar detector: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid native sidecar mode %q", config.NativeSidecars)
+	}
+
+	var serviceMonitor *ServiceMonitor
+	switch config.ServiceCheck {
+	case ServiceCheckOff, "":
+	case ServiceCheckWarn, ServiceCheckDeny:
+		serviceMonitor, err = NewServiceMonitor(0, config.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create service monitor: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid service check mode %q", config.ServiceCheck)
+	}
+
+	var namespaceMonitor *NamespaceMonitor
+	if config.NamespaceSelectors {
+		namespaceMonitor, err = NewNamespaceMonitor(0, config.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create namespace monitor: %w", err)
+		}
+	}
+
+	if config.ImageLockStrict && config.ImageLockFile == "" {
+		return nil, fmt.Errorf("config.ImageLockFile is required when config.ImageLockStrict is set")
+	}
+
 	monitor, err := NewSideCarMonitor(config.SideCarConfigFile, config.Logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create side car monitor: %w", err)
 	}
 
 	mutator := &Mutator{
-		sideCars:                atomic.Value{},
+		sideCarConfig:           atomic.Value{},
 		sideCarMonitor:          monitor,
 		shawarmaImage:           config.ShawarmaImage,
-		nativeSidecars:          config.NativeSidecars,
+		imageLockStrict:         config.ImageLockStrict,
+		verifyFailOpen:          config.VerifyFailOpen,
+		serviceCheckMode:        config.ServiceCheck,
+		serviceMonitor:          serviceMonitor,
+		namespaceMonitor:        namespaceMonitor,
+		nativeSidecarMode:       config.NativeSidecars,
+		nativeSidecarDetector:   nativeSidecarDetector,
 		shawarmaServiceAcctName: config.ShawarmaServiceAcctName,
 		shawarmaSecretTokenName: config.ShawarmaSecretTokenName,
+		defaultSideCar:          config.DefaultSideCar,
+		tokens:                  config.Tokens,
+		ignoreNamespaces:        ignoreNamespaces,
+		onlyNamespaces:          onlyNamespaces,
 		serviceAcctMonitors:     NewServiceAcctMonitorSet(config.Logger),
 		Logger:                  config.Logger,
 	}
 
 	go func() {
 		for sideCarConfig := range monitor.GetOutput() {
-			mutator.sideCars.Store(sideCarConfig)
+			mutator.sideCarConfig.Store(sideCarConfig)
 
 			mutator.Logger.Info("Sidecar config loaded")
 		}
@@ -125,6 +261,44 @@ func NewMutator(config *MutatorConfig) (*Mutator, error) {
 		return nil, fmt.Errorf("failed to start side car monitor: %w", err)
 	}
 
+	if config.ImageLockFile != "" {
+		imageLockMonitor, err := NewImageLockMonitor(config.ImageLockFile, config.Logger)
+		if err != nil {
+			mutator.Shutdown()
+			return nil, fmt.Errorf("failed to create image lock monitor: %w", err)
+		}
+
+		go func() {
+			for imageLock := range imageLockMonitor.GetOutput() {
+				mutator.imageLock.Store(imageLock)
+
+				mutator.Logger.Info("Image lock file loaded")
+			}
+		}()
+
+		mutator.imageLockMonitor = imageLockMonitor
+		if err := imageLockMonitor.Start(); err != nil {
+			mutator.Shutdown()
+			return nil, fmt.Errorf("failed to start image lock monitor: %w", err)
+		}
+	}
+
+	if nativeSidecarDetector != nil {
+		nativeSidecarDetector.Start()
+	}
+
+	if serviceMonitor != nil {
+		serviceMonitor.Start()
+	}
+
+	if namespaceMonitor != nil {
+		namespaceMonitor.Start()
+	}
+
+	mutator.Logger.Info("Native sidecar mode",
+		zap.String("mode", string(config.NativeSidecars)),
+		zap.String("status", mutator.NativeSidecarStatus()))
+
 	return mutator, nil
 }
 
@@ -139,22 +313,67 @@ func (mutator *Mutator) Shutdown() {
 		mutator.sideCarMonitor.Shutdown()
 		mutator.sideCarMonitor = nil
 	}
+
+	if mutator.imageLockMonitor != nil {
+		mutator.imageLockMonitor.Shutdown()
+		mutator.imageLockMonitor = nil
+	}
+
+	if mutator.nativeSidecarDetector != nil {
+		mutator.nativeSidecarDetector.Stop()
+		mutator.nativeSidecarDetector = nil
+	}
+
+	if mutator.serviceMonitor != nil {
+		mutator.serviceMonitor.Stop()
+		mutator.serviceMonitor = nil
+	}
+
+	if mutator.namespaceMonitor != nil {
+		mutator.namespaceMonitor.Stop()
+		mutator.namespaceMonitor = nil
+	}
 }
 
-func (mutator *Mutator) GetSideCars() map[string]*SideCar {
-	val := mutator.sideCars.Load()
+func (mutator *Mutator) GetSideCarConfig() *SideCarConfig {
+	val := mutator.sideCarConfig.Load()
 	if val == nil {
-		return make(map[string]*SideCar)
+		return &SideCarConfig{SideCars: make(map[string]*NamedSideCar)}
+	}
+	sideCarConfig, ok := val.(*SideCarConfig)
+	if !ok {
+		return &SideCarConfig{SideCars: make(map[string]*NamedSideCar)}
+	}
+	return sideCarConfig
+}
+
+// getImageLock returns the current image lock, or nil if no image lock file is configured
+func (mutator *Mutator) getImageLock() *ImageLock {
+	if mutator.imageLockMonitor == nil {
+		return nil
 	}
-	sideCars, ok := val.(map[string]*SideCar)
+
+	imageLock, ok := mutator.imageLock.Load().(*ImageLock)
 	if !ok {
-		return make(map[string]*SideCar)
+		// Not yet loaded, pin nothing so that strict mode rejects images
+		return &ImageLock{images: make(map[string]string)}
 	}
-	return sideCars
+	return imageLock
+}
+
+func (mutator *Mutator) GetSideCars() map[string]*NamedSideCar {
+	return mutator.GetSideCarConfig().SideCars
 }
 
 /*Mutate function performs the actual mutation of pod spec*/
 func (mutator *Mutator) Mutate(req []byte) ([]byte, error) {
+	return review(req, func(request *v1.AdmissionRequest) *v1.AdmissionResponse {
+		return mutate(request, mutator)
+	})
+}
+
+// review decodes an AdmissionReview request, and encodes the response from the handler using the same version
+func review(req []byte, handler func(*v1.AdmissionRequest) *v1.AdmissionResponse) ([]byte, error) {
 	admissionReviewResp := v1.AdmissionReview{}
 	admissionReviewReq := v1.AdmissionRequest{}
 	var admissionResponse *v1.AdmissionResponse
@@ -172,7 +391,7 @@ func (mutator *Mutator) Mutate(req []byte) ([]byte, error) {
 	_, actualGVK, err := deserializer.Decode(req, nil, &ar)
 
 	if err == nil && ar.Request != nil {
-		admissionResponse = mutate(&admissionReviewReq, mutator)
+		admissionResponse = handler(&admissionReviewReq)
 	} else {
 		message := "Failed to decode request"
 
@@ -214,14 +433,80 @@ func mutate(req *v1.AdmissionRequest, mutator *Mutator) *v1.AdmissionResponse {
 		return mutator.errorResponse(req.UID, err)
 	}
 
-	if sideCarNames, ok := shouldMutate(systemNameSpaces, &pod.ObjectMeta, req.Namespace, mutator); ok {
-		annotations := map[string]string{sideCarInjectionStatusAnnotation: injectedValue}
-		patchBytes, err := createPatch(&pod, req.Namespace, sideCarNames, mutator, annotations)
+	// Atomic get of the current side cars to prevent errors if they mutate while we're processing
+	sideCarConfig := mutator.GetSideCarConfig()
+
+	warnings := getAnnotationWarnings(pod.Annotations, sideCarConfig)
+
+	podLogger := mutator.Logger.With(
+		zap.String("podName", getPodName(&pod.ObjectMeta)),
+		zap.String("namespace", req.Namespace))
+
+	injection, ok := shouldMutate(&pod.ObjectMeta, req.Namespace, sideCarConfig, mutator)
+	if ok {
+		ok = applyOwnerPolicy(injection, &pod.ObjectMeta, sideCarConfig, podLogger)
+	}
+
+	if ok {
+		namespace := req.Namespace
+		if namespace == "" {
+			namespace = pod.Namespace
+		}
+
+		if err := mutator.checkService(pod.Annotations, namespace, injection, podLogger); err != nil {
+			if mutator.serviceCheckMode == ServiceCheckDeny {
+				return mutator.errorResponse(req.UID, err)
+			}
+
+			podLogger.Warn("Service check failed",
+				zap.Error(err))
+			warnings = append(warnings, err.Error())
+		}
+
+		injection.nativeOverride = getNativeSidecarOverride(&pod.ObjectMeta, podLogger)
+		sideCarMode := injection.sideCarMode(mutator)
+
+		annotations := map[string]string{
+			sideCarInjectionStatusAnnotation: injectedValue,
+			sideCarInjectedListAnnotation:    strings.Join(injection.sideCarNames, ","),
+			sideCarModeStatusAnnotation:      sideCarMode,
+		}
+		maps.Copy(annotations, injection.annotations)
+
+		patchBytes, err := createPatch(&pod, req.Namespace, injection, sideCarConfig, mutator, annotations)
 		if err != nil {
 			return mutator.errorResponse(req.UID, err)
 		}
+		warnings = append(warnings, injection.warnings...)
+
+		if patchBytes == nil {
+			podLogger.Info("AdmissionResponse: Sidecars already injected, no changes required")
+
+			return &v1.AdmissionResponse{
+				UID:      req.UID,
+				Allowed:  true,
+				Warnings: warnings,
+			}
+		}
+
+		if err := verifyPatch(&pod, patchBytes); err != nil {
+			if !mutator.verifyFailOpen {
+				return mutator.errorResponse(req.UID, fmt.Errorf("sidecar injection would create an invalid pod: %w", err))
+			}
+
+			podLogger.Error("AdmissionResponse: Sidecar injection would create an invalid pod, admitting without sidecars",
+				zap.ByteString("patch", patchBytes),
+				zap.Error(err))
+
+			return &v1.AdmissionResponse{
+				UID:      req.UID,
+				Allowed:  true,
+				Warnings: warnings,
+			}
+		}
 
 		mutator.Logger.Info("AdmissionResponse: Patch",
+			zap.String("sidecarMode", sideCarMode),
 			zap.ByteString("patch", patchBytes))
 		pt := v1.PatchTypeJSONPatch
 		return &v1.AdmissionResponse{
@@ -229,17 +514,19 @@ func mutate(req *v1.AdmissionRequest, mutator *Mutator) *v1.AdmissionResponse {
 			Allowed:   true,
 			Patch:     patchBytes,
 			PatchType: &pt,
+			Warnings:  warnings,
 		}
 	}
 
 	return &v1.AdmissionResponse{
-		Allowed: true,
+		Allowed:  true,
+		Warnings: warnings,
 	}
 }
 
 func (mutator *Mutator) errorResponse(uid types.UID, err error) *v1.AdmissionResponse {
 	mutator.Logger.Error("AdmissionReview failed",
-		zap.String("uid", string(uid)), 
+		zap.String("uid", string(uid)),
 		zap.Error(err))
 
 	return &v1.AdmissionResponse{
@@ -249,28 +536,39 @@ func (mutator *Mutator) errorResponse(uid types.UID, err error) *v1.AdmissionRes
 	}
 }
 
+// getPodName returns the pod name for logging, which is often only a prefix during admission
+func getPodName(metadata *metav1.ObjectMeta) string {
+	if metadata.Name == "" {
+		return metadata.GenerateName
+	}
+	return metadata.Name
+}
+
 func unMarshall(req *v1.AdmissionRequest) (corev1.Pod, error) {
 	var pod corev1.Pod
 	err := json.Unmarshal(req.Object.Raw, &pod)
 	return pod, err
 }
 
-func shouldMutate(ignoredList []string, metadata *metav1.ObjectMeta, namespace string, mutator *Mutator) ([]string, bool) {
-	podName := metadata.Name
-	if podName == "" {
-		podName = metadata.GenerateName
+func shouldMutate(metadata *metav1.ObjectMeta, namespace string, sideCarConfig *SideCarConfig, mutator *Mutator) (*injection, bool) {
+	podName := getPodName(metadata)
+
+	if namespace == "" {
+		namespace = metadata.Namespace
 	}
 
 	logger := mutator.Logger.With(
-		zap.String("podName", podName), 
+		zap.String("podName", podName),
 		zap.String("namespace", namespace))
 
-	for _, namespace := range ignoredList {
-		if metadata.Namespace == namespace {
-			logger.Info("Skipping mutation for pod in special namespace")
+	if reason, ok := checkNamespace(namespace,
+		[]*patternMatcher{mutator.ignoreNamespaces, sideCarConfig.ignoreNamespaces},
+		[]*patternMatcher{mutator.onlyNamespaces, sideCarConfig.onlyNamespaces}); !ok {
+		logger.Info("Skipping mutation for pod in excluded namespace",
+			zap.String("rule", "namespace"),
+			zap.String("reason", reason))
 
-			return nil, false
-		}
+		return nil, false
 	}
 
 	annotations := metadata.GetAnnotations()
@@ -278,45 +576,135 @@ func shouldMutate(ignoredList []string, metadata *metav1.ObjectMeta, namespace s
 		annotations = map[string]string{}
 	}
 
-	if status, ok := annotations[sideCarInjectionStatusAnnotation]; ok && strings.ToLower(status) == injectedValue {
-		logger.Info("Skipping mutation for pod. Has been mutated already")
+	inject, injectRule, hasInject := getInjectOverride(metadata, logger)
+	if hasInject && !inject {
+		logger.Info("Skipping mutation for pod. Injection disabled",
+			zap.String("rule", injectRule))
 
 		return nil, false
 	}
 
-	selectedSideCarName := sideCarName
-	if mutator.shawarmaSecretTokenName != "" || mutator.shawarmaServiceAcctName != "" {
-		// We need to attach a token, use the alternate side car format
-		selectedSideCarName = sideCarWithTokenName
+	selectedSideCarNames := mutator.getDefaultSideCarNames()
+	if names := parseSideCarNames(annotations[sideCarSelectionAnnotation]); len(names) > 0 {
+		selectedSideCarNames = names
+	} else if names := parseSideCarNames(annotations[sideCarInjectedListAnnotation]); len(names) > 0 {
+		// Reinvocations and copies of a previously injected pod should keep the same sidecars,
+		// injected containers are detected when creating the patch
+		selectedSideCarNames = names
+	}
+
+	if hasInject {
+		logger.Info("shawarma injection for pod",
+			zap.String("rule", injectRule),
+			zap.Strings("sidecars", selectedSideCarNames))
+
+		return &injection{sideCarNames: selectedSideCarNames, rule: injectRule}, true
 	}
 
 	if serviceName, ok := annotations[sideCarInjectionAnnotation]; ok {
 		if len(serviceName) > 0 {
 			logger.Info("shawarma injection for pod",
+				zap.String("rule", sideCarInjectionAnnotation),
 				zap.String("serviceName", serviceName),
-				zap.String("sidecar", selectedSideCarName))
+				zap.Strings("sidecars", selectedSideCarNames))
 
-			return []string{selectedSideCarName}, true
+			return &injection{sideCarNames: selectedSideCarNames, rule: sideCarInjectionAnnotation}, true
 		}
 	}
 
 	if serviceLabels, ok := annotations[sideCarLabelInjectionAnnotation]; ok {
 		if len(serviceLabels) > 0 {
 			logger.Info("shawarma injection for pod",
+				zap.String("rule", sideCarLabelInjectionAnnotation),
 				zap.String("serviceLabels", serviceLabels),
-				zap.String("sidecar", selectedSideCarName))
-			return []string{selectedSideCarName}, true
+				zap.Strings("sidecars", selectedSideCarNames))
+			return &injection{sideCarNames: selectedSideCarNames, rule: sideCarLabelInjectionAnnotation}, true
+		}
+	}
+
+	// Namespace labels are only read once, and only if a match rule has a namespace selector
+	namespaceLabels := sync.OnceValues(func() (labels.Set, bool) {
+		return mutator.getNamespaceLabels(namespace, logger)
+	})
+
+	if matchedSideCarNames, serviceName := sideCarConfig.matchRules(metadata, namespace, namespaceLabels); len(matchedSideCarNames) > 0 {
+		logger.Info("shawarma injection for pod",
+			zap.String("rule", "match"),
+			zap.String("serviceName", serviceName),
+			zap.Strings("sidecars", matchedSideCarNames))
+
+		result := &injection{sideCarNames: matchedSideCarNames, rule: "match"}
+		if serviceName != "" {
+			// Pass the service name to the sidecar the same way as if it were annotated
+			result.annotations = map[string]string{sideCarInjectionAnnotation: serviceName}
 		}
+		return result, true
 	}
 
 	logger.Info("Skipping mutation for pod. No action required")
 	return nil, false
 }
 
-func createPatch(pod *corev1.Pod, namespace string, sideCarNames []string, mutator *Mutator, annotations map[string]string) ([]byte, error) {
+// getInjectOverride reads the inject annotation, falling back to the inject label. It returns the
+// requested value, a description of where it was found, and false if neither is present and valid.
+func getInjectOverride(metadata *metav1.ObjectMeta, logger *zap.Logger) (bool, string, bool) {
+	sources := []struct {
+		values map[string]string
+		rule   string
+	}{
+		{metadata.GetAnnotations(), "annotation " + sideCarInjectAnnotation},
+		{metadata.GetLabels(), "label " + sideCarInjectAnnotation},
+	}
+
+	for _, source := range sources {
+		if value, ok := source.values[sideCarInjectAnnotation]; ok {
+			inject, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				logger.Warn("Ignoring invalid inject value",
+					zap.String("rule", source.rule),
+					zap.String("value", value))
+				continue
+			}
+
+			return inject, source.rule, true
+		}
+	}
+
+	return false, "", false
+}
+
+// getDefaultSideCarNames returns the sidecar templates used when a pod doesn't select any by annotation
+func (mutator *Mutator) getDefaultSideCarNames() []string {
+	if names := parseSideCarNames(mutator.defaultSideCar); len(names) > 0 {
+		return names
+	}
+
+	if mutator.shawarmaSecretTokenName != "" || mutator.shawarmaServiceAcctName != "" {
+		// We need to attach a token, use the alternate side car format
+		return []string{sideCarWithTokenName}
+	}
+
+	return []string{sideCarName}
+}
+
+// parseSideCarNames splits a comma-delimited list of sidecar template names, preserving order and removing duplicates
+func parseSideCarNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
 
-	var patch []patchOperation
+func createPatch(pod *corev1.Pod, namespace string, injection *injection, sideCarConfig *SideCarConfig, mutator *Mutator, annotations map[string]string) ([]byte, error) {
+
+	var operations []patch.Operation
 	var containers []corev1.Container
+	var initContainers []placedContainers
+	var podPatches []namedPodPatch
 	var volumes []corev1.Volume
 	var imagePullSecrets []corev1.LocalObjectReference
 
@@ -325,11 +713,16 @@ func createPatch(pod *corev1.Pod, namespace string, sideCarNames []string, mutat
 	existingAnnotations := pod.ObjectMeta.GetAnnotations()
 	if existingAnnotations != nil {
 		if image, ok := existingAnnotations[sideCarInjectionImageAnnotation]; ok {
-			mutator.Logger.Info("Overriding Shawarma image", 
+			if err := sideCarConfig.ImageOverride.check(image); err != nil {
+				return nil, fmt.Errorf("invalid annotation %s: %w", sideCarInjectionImageAnnotation, err)
+			}
+
+			mutator.Logger.Info("Overriding Shawarma image",
 				zap.String("namespace", namespace),
 				zap.String("podName", pod.GetObjectMeta().GetName()),
 				zap.String("image", image))
 
+			injection.warn("the Shawarma image is overridden by annotation %s, using %s", sideCarInjectionImageAnnotation, image)
 			shawarmaImage = image
 		}
 	}
@@ -354,159 +747,148 @@ func createPatch(pod *corev1.Pod, namespace string, sideCarNames []string, mutat
 		}
 	}
 
-	// Atomic get of the current side cars to prevent errors if they mutate while we're processing
-	sideCars := mutator.GetSideCars()
-	for _, name := range sideCarNames {
-		if sideCarSrc, ok := sideCars[name]; ok {
-			sideCar := sideCarSrc.DeepCopy()
+	tokens := mutator.resolveTokens(sideCarConfig.Tokens, existingAnnotations)
+	templateData := newTemplateData(pod, namespace, tokens, injection, mutator)
 
-			for i := range sideCar.Containers {
-				container := &sideCar.Containers[i]
+	tokens[imageToken] = shawarmaImage
+	if secretName != "" {
+		tokens[tokenNameToken] = secretName
+	}
 
-				if container.Image == "|SHAWARMA_IMAGE|" {
-					container.Image = shawarmaImage
-				}
+	logger := mutator.Logger.With(
+		zap.String("podName", getPodName(&pod.ObjectMeta)),
+		zap.String("namespace", namespace))
+	names := newPodNames(pod)
+	appContainers := newAppContainerChanges()
+	injectedContainers := getInjectedContainerNames(pod, injection.sideCarNames, sideCarConfig)
+	podFields := newPodFieldChanges()
+
+	// Atomic get of the current image lock to prevent inconsistent pins if it changes while we're processing
+	imageLock := mutator.getImageLock()
+
+	resources, err := getResourceOverrides(&pod.ObjectMeta, sideCarConfig.ResourceBounds, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range injection.sideCarNames {
+		if sideCarSrc, ok := sideCarConfig.SideCars[name]; ok {
+			sideCar := sideCarSrc.Sidecar.DeepCopy()
+
+			if err := sideCar.renderTemplates(templateData); err != nil {
+				return nil, fmt.Errorf("failed to render sidecar template %q: %w", name, err)
+			}
+
+			if err := sideCar.replaceTokens(tokens); err != nil {
+				return nil, fmt.Errorf("failed to replace tokens in sidecar template %q: %w", name, err)
+			}
+
+			if missingServiceAccountToken(pod, sideCar, shawarmaImage) {
+				injection.warn("automountServiceAccountToken is false, the %s sidecar will not have credentials for the Kubernetes API", name)
+			}
+
+			if err := sideCar.applyResourceOverrides(resources); err != nil {
+				return nil, fmt.Errorf("failed to override resources in sidecar template %q: %w", name, err)
+			}
+
+			if err := sideCar.rewriteImages(func(image string) (string, error) {
+				return mutator.resolveImage(image, sideCarConfig, imageLock, logger)
+			}); err != nil {
+				return nil, fmt.Errorf("failed to resolve images in sidecar template %q: %w", name, err)
+			}
+
+			if err := resolveCollisions(pod, sideCarSrc, sideCar, names, volumes, logger); err != nil {
+				return nil, err
+			}
+
+			if err := appContainers.add(pod, sideCarSrc, sideCar, injectedContainers, logger); err != nil {
+				return nil, err
+			}
+
+			if err := podFields.add(pod, sideCarSrc, sideCar, logger); err != nil {
+				return nil, err
+			}
+
+			native := injection.isNative(name, mutator)
+			if native && !mutator.nativeSidecarsSupported() {
+				logger.Info("Native sidecars are not supported by the cluster, injecting regular containers",
+					zap.String("sidecar", name))
+				native = false
+			}
+
+			// The template's init containers run before its native sidecars are started
+			placed := placedContainers{
+				sideCarName: name,
+				placement:   sideCarSrc.Placement,
+				containers:  sideCar.InitContainers,
+			}
 
-				if mutator.nativeSidecars {
+			if native {
+				for i := range sideCar.Containers {
 					// Set restart policy to Always so it's a sidecar and not a normal init container
 					restartPolicy := corev1.ContainerRestartPolicyAlways
-					container.RestartPolicy = &restartPolicy
+					sideCar.Containers[i].RestartPolicy = &restartPolicy
 				}
+
+				placed.containers = append(placed.containers, sideCar.Containers...)
+			} else {
+				containers = append(containers, sideCar.Containers...)
 			}
 
-			// Apply the configured volumes
-			for i := range sideCar.Volumes {
-				volume := &sideCar.Volumes[i]
-
-				if secretName != "" {
-					if volume.Secret != nil {
-						// Update secret volume sources
-
-						if volume.Secret.SecretName == "|SHAWARMA_TOKEN_NAME|" {
-							volume.Secret.SecretName = secretName
-						}
-					} else if volume.Projected != nil {
-						// Also update secret sources in projected volumes
-
-						for i := range volume.Projected.Sources {
-							source := &volume.Projected.Sources[i]
-							if source.Secret != nil && source.Secret.Name == "|SHAWARMA_TOKEN_NAME|" {
-								source.Secret.Name = secretName
-							}
-						}
-					}
-				}
+			if len(placed.containers) > 0 {
+				initContainers = append(initContainers, placed)
 			}
 
-			containers = append(containers, sideCar.Containers...)
 			volumes = append(volumes, sideCar.Volumes...)
-			imagePullSecrets = append(imagePullSecrets, sideCar.ImagePullSecrets...)
+
+			// Pod patches aren't idempotent, so they're only applied when the template is first injected
+			if sideCarSrc.PodPatch != nil && !isInjected(pod, name) {
+				podPatches = append(podPatches, namedPodPatch{sideCarName: name, podPatch: sideCarSrc.PodPatch})
+			}
+
+			// Templates injected together may share pull secrets, and the pod may already have them
+			for _, secret := range sideCar.ImagePullSecrets {
+				if !slices.Contains(imagePullSecrets, secret) && !slices.Contains(pod.Spec.ImagePullSecrets, secret) {
+					imagePullSecrets = append(imagePullSecrets, secret)
+				}
+			}
 		} else {
-			return nil, fmt.Errorf("did not find one or more sidecars to inject %v", sideCarNames)
+			return nil, fmt.Errorf("sidecar template %q is not defined in the sidecar configuration", name)
 		}
 	}
 
-	if mutator.nativeSidecars {
-		patch = append(patch, addContainer(pod.Spec.InitContainers, containers, "/spec/initContainers")...)
-	} else {
-		patch = append(patch, addContainer(pod.Spec.Containers, containers, "/spec/containers")...)
-	}
+	// Update existing containers first, before their indexes are affected by added containers
+	operations = append(operations, appContainers.createPatch(pod)...)
+	operations = append(operations, addInitContainers(pod.Spec.InitContainers, initContainers, "/spec/initContainers", logger)...)
+	operations = append(operations, patch.AppendToList(pod.Spec.Containers, containers, "/spec/containers")...)
 
-	patch = append(patch, addVolume(pod.Spec.Volumes, volumes, "/spec/volumes")...)
-	patch = append(patch, addImagePullSecrets(pod.Spec.ImagePullSecrets, imagePullSecrets, "/spec/imagePullSecrets")...)
-	patch = append(patch, updateAnnotation(pod.Annotations, annotations)...)
-
-	return json.Marshal(patch)
-}
+	operations = append(operations, patch.AppendToList(pod.Spec.Volumes, volumes, "/spec/volumes")...)
+	operations = append(operations, patch.AppendToList(pod.Spec.ImagePullSecrets, imagePullSecrets, "/spec/imagePullSecrets")...)
+	operations = append(operations, podFields.createPatch(pod)...)
 
-func addContainer(target, added []corev1.Container, basePath string) []patchOperation {
-	var patch []patchOperation
-	first := len(target) == 0
-	var value any
-	for _, add := range added {
-		value = add
-		path := basePath
-		if first {
-			first = false
-			value = []corev1.Container{add}
-		} else {
-			path = path + "/-"
+	// Annotations added by the webhook take precedence over annotations from the templates
+	for key, value := range podFields.annotations {
+		if _, ok := annotations[key]; !ok {
+			annotations[key] = value
 		}
-		patch = append(patch, patchOperation{
-			Op:    "add",
-			Path:  path,
-			Value: value,
-		})
 	}
-	return patch
-}
+	operations = append(operations, patch.UpdateMap(pod.Annotations, annotations, "/metadata/annotations")...)
 
-func addVolume(target, added []corev1.Volume, basePath string) []patchOperation {
-	var patch []patchOperation
-	first := len(target) == 0
-	var value any
-	for _, add := range added {
-		value = add
-		path := basePath
-		if first {
-			first = false
-			value = []corev1.Volume{add}
-		} else {
-			path = path + "/-"
+	if len(podPatches) > 0 {
+		if operations, err = applyPodPatches(pod, operations, podPatches); err != nil {
+			return nil, err
 		}
-		patch = append(patch, patchOperation{
-			Op:    "add",
-			Path:  path,
-			Value: value,
-		})
 	}
-	return patch
-}
 
-func addImagePullSecrets(target, added []corev1.LocalObjectReference, basePath string) []patchOperation {
-	var patch []patchOperation
-	first := len(target) == 0
-	var value any
-	for _, add := range added {
-		value = add
-		path := basePath
-		if first {
-			first = false
-			value = []corev1.LocalObjectReference{add}
-		} else {
-			path = path + "/-"
-		}
-		patch = append(patch, patchOperation{
-			Op:    "add",
-			Path:  path,
-			Value: value,
-		})
+	if len(operations) == 0 {
+		return nil, nil
 	}
-	return patch
+
+	return json.Marshal(operations)
 }
 
-func updateAnnotation(target map[string]string, added map[string]string) []patchOperation {
-	var patch []patchOperation
-	if target == nil {
-		target = map[string]string{}
-	}
-	for key, value := range added {
-		keyEscaped := strings.Replace(key, "/", "~1", -1)
-
-		_, ok := target[key]
-		if ok {
-			patch = append(patch, patchOperation{
-				Op:    "replace",
-				Path:  "/metadata/annotations/" + keyEscaped,
-				Value: value,
-			})
-		} else {
-			patch = append(patch, patchOperation{
-				Op:    "add",
-				Path:  "/metadata/annotations/" + keyEscaped,
-				Value: value,
-			})
-		}
-	}
-	return patch
+// hasContainer returns true if the pod has a container or init container with the given name
+func hasContainer(pod *corev1.Pod, name string) bool {
+	isNamed := func(c corev1.Container) bool { return c.Name == name }
+	return slices.ContainsFunc(pod.Spec.Containers, isNamed) || slices.ContainsFunc(pod.Spec.InitContainers, isNamed)
 }
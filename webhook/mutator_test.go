@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newTestMutator creates a mutator using the sidecar configuration, without starting any monitors
+func newTestMutator(t *testing.T, sideCarConfig string) *Mutator {
+	t.Helper()
+
+	configFile := filepath.Join(t.TempDir(), "sidecar.yaml")
+	if err := os.WriteFile(configFile, []byte(sideCarConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadSideCars(configFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("failed to load sidecar config: %v", err)
+	}
+
+	mutator := &Mutator{
+		shawarmaImage:       "centeredge/shawarma:2.0.0",
+		nativeSidecarMode:   NativeSidecarsDisabled,
+		serviceAcctMonitors: NewServiceAcctMonitorSet(zap.NewNop()),
+		Logger:              zap.NewNop(),
+	}
+	mutator.sideCarConfig.Store(config)
+	return mutator
+}
+
+// mutatePod runs the mutation and returns the pod with the patch applied, and the patch
+func mutatePod(t *testing.T, mutator *Mutator, pod *corev1.Pod) (*corev1.Pod, []byte) {
+	t.Helper()
+
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := mutate(&v1.AdmissionRequest{Namespace: "default", Object: runtime.RawExtension{Raw: raw}}, mutator)
+	if !response.Allowed {
+		t.Fatalf("pod was not allowed: %s", response.Result.Message)
+	}
+
+	if response.Patch == nil {
+		return pod, nil
+	}
+
+	return applyPatch(t, pod, response.Patch), response.Patch
+}
+
+// applyPatch applies a JSON patch to a copy of the pod
+func applyPatch(t *testing.T, pod *corev1.Pod, patchBytes []byte) *corev1.Pod {
+	t.Helper()
+
+	document, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := jsonpatch.DecodePatch(patchBytes)
+	if err != nil {
+		t.Fatalf("invalid patch %s: %v", patchBytes, err)
+	}
+
+	if document, err = decoded.Apply(document); err != nil {
+		t.Fatalf("failed to apply patch %s: %v", patchBytes, err)
+	}
+
+	var patched corev1.Pod
+	if err := json.Unmarshal(document, &patched); err != nil {
+		t.Fatal(err)
+	}
+	return &patched
+}
+
+func TestShutdownTwice(t *testing.T) {
+	mutator := newTestMutator(t, "sidecars: []\n")
+	mutator.nativeSidecarMode = NativeSidecarsAuto
+	mutator.nativeSidecarDetector = &NativeSidecarDetector{stop: make(chan struct{}), logger: zap.NewNop()}
+
+	mutator.Shutdown()
+	mutator.Shutdown()
+}
@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"fmt"
+)
+
+// checkNamespace returns a reason if injection should be skipped for pods in the namespace. The ignore lists
+// take precedence, and if any allow lists are configured the namespace must match at least one of them.
+func checkNamespace(namespace string, ignored []*patternMatcher, only []*patternMatcher) (string, bool) {
+	for _, matcher := range ignored {
+		if pattern, ok := matcher.match(namespace); ok {
+			return fmt.Sprintf("namespace matches ignored pattern %s", pattern), false
+		}
+	}
+
+	hasAllowList := false
+	for _, matcher := range only {
+		if matcher.isEmpty() {
+			continue
+		}
+
+		hasAllowList = true
+		if _, ok := matcher.match(namespace); ok {
+			return "", true
+		}
+	}
+
+	if hasAllowList {
+		return "namespace does not match any allowed pattern", false
+	}
+
+	return "", true
+}
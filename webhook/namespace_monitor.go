@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespaceMonitor keeps a cache of the Namespaces in the cluster using an informer
+type NamespaceMonitor struct {
+	informer cache.SharedIndexInformer
+	lister   corev1listers.NamespaceLister
+	stop     chan struct{}
+	logger   *zap.Logger
+}
+
+// NewNamespaceMonitor creates a monitor for all Namespaces, the Kubernetes client must be initialized
+func NewNamespaceMonitor(resync time.Duration, logger *zap.Logger) (*NamespaceMonitor, error) {
+	if k8sClient == nil {
+		return nil, fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	namespaces := informers.NewSharedInformerFactory(k8sClient, resync).Core().V1().Namespaces()
+
+	return &NamespaceMonitor{
+		informer: namespaces.Informer(),
+		lister:   namespaces.Lister(),
+		stop:     make(chan struct{}),
+		logger:   logger,
+	}, nil
+}
+
+// Start the monitor, the cache is filled in the background
+func (monitor *NamespaceMonitor) Start() {
+	go monitor.informer.Run(monitor.stop)
+
+	go func() {
+		if cache.WaitForCacheSync(monitor.stop, monitor.informer.HasSynced) {
+			monitor.logger.Info("Namespace cache synced")
+		}
+	}()
+}
+
+// Stop the monitor
+func (monitor *NamespaceMonitor) Stop() {
+	close(monitor.stop)
+}
+
+// getLabels returns the labels of the named Namespace, reading it from the API server if the cache isn't yet synced
+// or the Namespace was created since the cache was updated
+func (monitor *NamespaceMonitor) getLabels(name string) (labels.Set, error) {
+	if monitor.informer.HasSynced() {
+		namespace, err := monitor.lister.Get(name)
+		if err == nil {
+			return labels.Set(namespace.Labels), nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	namespace, err := k8sClient.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return labels.Set(namespace.Labels), nil
+}
+
+// getNamespaceLabels returns the labels of the namespace for match rules with a namespace selector, returns false if
+// namespace selectors aren't enabled or the namespace can't be read
+func (mutator *Mutator) getNamespaceLabels(namespace string, logger *zap.Logger) (labels.Set, bool) {
+	if mutator.namespaceMonitor == nil {
+		logger.Warn("Namespace selectors are not enabled, skipping match rules with a namespace selector")
+		return nil, false
+	}
+
+	namespaceLabels, err := mutator.namespaceMonitor.getLabels(namespace)
+	if err != nil {
+		logger.Warn("Unable to read namespace labels, skipping match rules with a namespace selector",
+			zap.Error(err))
+		return nil, false
+	}
+
+	return namespaceLabels, true
+}
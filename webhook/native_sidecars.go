@@ -0,0 +1,273 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+/*NativeSidecarMode determines whether sidecars are injected as native sidecars*/
+type NativeSidecarMode string
+
+const (
+	// NativeSidecarsEnabled always injects native sidecars
+	NativeSidecarsEnabled NativeSidecarMode = "true"
+	// NativeSidecarsDisabled injects sidecars as regular containers
+	NativeSidecarsDisabled NativeSidecarMode = "false"
+	// NativeSidecarsAuto injects native sidecars if the cluster supports them
+	NativeSidecarsAuto NativeSidecarMode = "auto"
+
+	// Native sidecars are enabled by default beginning with Kubernetes 1.29
+	nativeSidecarFeatureGate = "SidecarContainers"
+	nativeSidecarMetric      = "kubernetes_feature_enabled"
+
+	// Values of the sidecar mode annotation
+	sideCarModeNative  = "native"
+	sideCarModeClassic = "classic"
+	sideCarModeMixed   = "mixed"
+)
+
+var nativeSidecarMinVersion = version.MajorMinor(1, 29)
+
+/*ParseNativeSidecarMode parses true, false, or auto*/
+func ParseNativeSidecarMode(value string) (NativeSidecarMode, error) {
+	if strings.EqualFold(value, string(NativeSidecarsAuto)) {
+		return NativeSidecarsAuto, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid native sidecar mode %q, must be true, false, or auto", value)
+	}
+	if enabled {
+		return NativeSidecarsEnabled, nil
+	}
+	return NativeSidecarsDisabled, nil
+}
+
+// NativeSidecarDetector periodically checks if the Kubernetes API server supports native sidecars
+type NativeSidecarDetector struct {
+	interval  time.Duration
+	supported bool
+	reason    string
+	mutex     sync.RWMutex
+	stop      chan struct{}
+	logger    *zap.Logger
+}
+
+// NewNativeSidecarDetector creates a detector which checks every interval, the Kubernetes client must be initialized
+func NewNativeSidecarDetector(interval time.Duration, logger *zap.Logger) (*NativeSidecarDetector, error) {
+	if k8sClient == nil {
+		return nil, fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	return &NativeSidecarDetector{
+		interval: interval,
+		reason:   "not yet detected",
+		stop:     make(chan struct{}),
+		logger:   logger,
+	}, nil
+}
+
+// Start the detector, the first check completes before returning
+func (detector *NativeSidecarDetector) Start() {
+	detector.check()
+
+	if detector.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(detector.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				detector.check()
+			case <-detector.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the detector
+func (detector *NativeSidecarDetector) Stop() {
+	close(detector.stop)
+}
+
+// Supported returns true if the cluster supports native sidecars, and the reason for the decision
+func (detector *NativeSidecarDetector) Supported() (bool, string) {
+	detector.mutex.RLock()
+	defer detector.mutex.RUnlock()
+
+	return detector.supported, detector.reason
+}
+
+func (detector *NativeSidecarDetector) check() {
+	supported, reason, err := detector.detect()
+	if err != nil {
+		// Keep the previous result, which is unsupported if detection has never succeeded
+		detector.logger.Warn("Failed to detect native sidecar support",
+			zap.Error(err))
+		return
+	}
+
+	detector.mutex.Lock()
+	changed := supported != detector.supported || reason != detector.reason
+	detector.supported = supported
+	detector.reason = reason
+	detector.mutex.Unlock()
+
+	if changed {
+		detector.logger.Info("Detected native sidecar support",
+			zap.Bool("nativeSidecars", supported),
+			zap.String("reason", reason))
+	}
+}
+
+func (detector *NativeSidecarDetector) detect() (bool, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The feature gate metric is the most accurate, but requires permission to read metrics
+	metrics, err := k8sClient.Discovery().RESTClient().Get().AbsPath("/metrics").DoRaw(ctx)
+	if err != nil {
+		detector.logger.Debug("Unable to read API server metrics, using the server version",
+			zap.Error(err))
+	} else if enabled, found := parseFeatureGateMetric(metrics, nativeSidecarFeatureGate); found {
+		if enabled {
+			return true, fmt.Sprintf("feature gate %s is enabled", nativeSidecarFeatureGate), nil
+		}
+		return false, fmt.Sprintf("feature gate %s is disabled", nativeSidecarFeatureGate), nil
+	}
+
+	info, err := k8sClient.Discovery().ServerVersion()
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get server version: %w", err)
+	}
+
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to parse server version %q: %w", info.GitVersion, err)
+	}
+
+	if serverVersion.AtLeast(nativeSidecarMinVersion) {
+		return true, fmt.Sprintf("server version %s", info.GitVersion), nil
+	}
+	return false, fmt.Sprintf("server version %s is older than v%s", info.GitVersion, nativeSidecarMinVersion), nil
+}
+
+// parseFeatureGateMetric finds the value of a feature gate in the Prometheus kubernetes_feature_enabled metric,
+// ex. kubernetes_feature_enabled{name="SidecarContainers",stage="BETA"} 1
+func parseFeatureGateMetric(metrics []byte, featureGate string) (enabled bool, found bool) {
+	nameLabel := fmt.Sprintf("name=%q", featureGate)
+
+	scanner := bufio.NewScanner(bytes.NewReader(metrics))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, nativeSidecarMetric+"{") || !strings.Contains(line, nameLabel) {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			return false, false
+		}
+		return value > 0, true
+	}
+
+	return false, false
+}
+
+// nativeSidecarsEnabled returns true if sidecars are injected as native sidecars by default
+func (mutator *Mutator) nativeSidecarsEnabled() bool {
+	switch mutator.nativeSidecarMode {
+	case NativeSidecarsEnabled:
+		return true
+	case NativeSidecarsAuto:
+		supported, _ := mutator.nativeSidecarDetector.Supported()
+		return supported
+	default:
+		return false
+	}
+}
+
+// nativeSidecarsSupported returns false if the cluster was detected not to support native sidecars
+func (mutator *Mutator) nativeSidecarsSupported() bool {
+	if mutator.nativeSidecarDetector == nil {
+		return true
+	}
+
+	supported, _ := mutator.nativeSidecarDetector.Supported()
+	return supported
+}
+
+// NativeSidecarStatus describes the native sidecar mode currently in use
+func (mutator *Mutator) NativeSidecarStatus() string {
+	switch mutator.nativeSidecarMode {
+	case NativeSidecarsEnabled:
+		return "Native sidecars: enabled"
+	case NativeSidecarsAuto:
+		supported, reason := mutator.nativeSidecarDetector.Supported()
+		if supported {
+			return fmt.Sprintf("Native sidecars: enabled (auto, %s)", reason)
+		}
+		return fmt.Sprintf("Native sidecars: disabled (auto, %s)", reason)
+	default:
+		return "Native sidecars: disabled"
+	}
+}
+
+// getNativeSidecarOverride returns the value of the pod's native sidecar annotation, or nil if not present or invalid
+func getNativeSidecarOverride(metadata *metav1.ObjectMeta, logger *zap.Logger) *bool {
+	value, ok := metadata.GetAnnotations()[sideCarNativeAnnotation]
+	if !ok {
+		return nil
+	}
+
+	native, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		logger.Warn("Ignoring invalid native sidecar value",
+			zap.String("annotation", sideCarNativeAnnotation),
+			zap.String("value", value))
+		return nil
+	}
+
+	logger.Info("Native sidecar mode overridden by annotation",
+		zap.Bool("nativeSidecars", native))
+	return &native
+}
+
+// sideCarMode describes how the injection's sidecars will be injected, native, classic, or mixed if the
+// sidecars are injected differently
+func (injection *injection) sideCarMode(mutator *Mutator) string {
+	supported := mutator.nativeSidecarsSupported()
+
+	mode := ""
+	for _, name := range injection.sideCarNames {
+		current := sideCarModeClassic
+		if supported && injection.isNative(name, mutator) {
+			current = sideCarModeNative
+		}
+
+		if mode != "" && mode != current {
+			return sideCarModeMixed
+		}
+		mode = current
+	}
+
+	return mode
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*OwnerPolicyAction is the action taken for pods owned by a specific kind of controller*/
+type OwnerPolicyAction string
+
+const (
+	// OwnerPolicyAllow injects the sidecar normally
+	OwnerPolicyAllow OwnerPolicyAction = "allow"
+	// OwnerPolicyDeny skips injecting the sidecar
+	OwnerPolicyDeny OwnerPolicyAction = "deny"
+	// OwnerPolicyNative injects the sidecar as a native sidecar, even if native sidecars are disabled
+	OwnerPolicyNative OwnerPolicyAction = "native"
+)
+
+func validateOwnerPolicy(policy map[string]OwnerPolicyAction) error {
+	for kind, action := range policy {
+		switch action {
+		case OwnerPolicyAllow, OwnerPolicyDeny, OwnerPolicyNative:
+		default:
+			return fmt.Errorf("invalid owner policy %q for kind %s, must be allow, deny, or native", action, kind)
+		}
+	}
+
+	return nil
+}
+
+// applyOwnerPolicy removes sidecars denied by their owner policy from the injection, and records sidecars
+// which must be injected as native sidecars. Returns false if no sidecars remain to be injected.
+func applyOwnerPolicy(injection *injection, metadata *metav1.ObjectMeta, sideCarConfig *SideCarConfig, logger *zap.Logger) bool {
+	ownerKind := getOwnerKind(metadata)
+
+	var allowed []string
+	for _, name := range injection.sideCarNames {
+		sideCar, ok := sideCarConfig.SideCars[name]
+		if !ok {
+			// Leave missing sidecars in place so that they are reported when creating the patch
+			allowed = append(allowed, name)
+			continue
+		}
+
+		switch sideCar.OwnerPolicy[ownerKind] {
+		case OwnerPolicyDeny:
+			logger.Info("Skipping sidecar due to owner policy",
+				zap.String("sidecar", name),
+				zap.String("ownerKind", ownerKind),
+				zap.String("reason", fmt.Sprintf("owner kind %s is denied", ownerKind)))
+			continue
+		case OwnerPolicyNative:
+			logger.Info("Forcing native sidecar due to owner policy",
+				zap.String("sidecar", name),
+				zap.String("ownerKind", ownerKind))
+
+			if injection.forceNative == nil {
+				injection.forceNative = make(map[string]bool)
+			}
+			injection.forceNative[name] = true
+		}
+
+		allowed = append(allowed, name)
+	}
+
+	injection.sideCarNames = allowed
+	return len(allowed) > 0
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// patternMatcher matches names, such as namespaces, against a list of patterns. Each pattern may be an exact name,
+// a glob such as "*-system", or a regular expression wrapped in slashes such as "/^team-[0-9]+$/".
+type patternMatcher struct {
+	patterns []namePattern
+}
+
+type namePattern struct {
+	source string
+	regex  *regexp.Regexp
+}
+
+func newPatternMatcher(patterns []string) (*patternMatcher, error) {
+	matcher := &patternMatcher{}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		compiled := namePattern{source: pattern}
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			regex, err := regexp.Compile("^(?:" + pattern[1:len(pattern)-1] + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+			}
+			compiled.regex = regex
+		} else if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+
+		matcher.patterns = append(matcher.patterns, compiled)
+	}
+
+	return matcher, nil
+}
+
+// isEmpty returns true if there are no patterns, nil matchers are empty
+func (matcher *patternMatcher) isEmpty() bool {
+	return matcher == nil || len(matcher.patterns) == 0
+}
+
+// match returns the first pattern which matches the name
+func (matcher *patternMatcher) match(name string) (string, bool) {
+	if matcher == nil {
+		return "", false
+	}
+
+	for _, pattern := range matcher.patterns {
+		if pattern.regex != nil {
+			if pattern.regex.MatchString(name) {
+				return pattern.source, true
+			}
+		} else if matched, _ := path.Match(pattern.source, name); matched {
+			return pattern.source, true
+		}
+	}
+
+	return "", false
+}
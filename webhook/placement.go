@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/CenterEdge/shawarma-webhook/patch"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+/*PlacementPosition is the position of native sidecars and init containers within the pod's init containers*/
+type PlacementPosition string
+
+const (
+	// PlacementFirst inserts containers before all existing init containers
+	PlacementFirst PlacementPosition = "first"
+	// PlacementLast appends containers after all existing init containers
+	PlacementLast PlacementPosition = "last"
+	// PlacementBefore inserts containers immediately before a named init container
+	PlacementBefore PlacementPosition = "before"
+	// PlacementAfter inserts containers immediately after a named init container
+	PlacementAfter PlacementPosition = "after"
+)
+
+/*Placement determines where native sidecars and init containers are inserted within the pod's init containers*/
+type Placement struct {
+	Position  PlacementPosition `json:"position,omitempty"`
+	Container string            `json:"container,omitempty"`
+}
+
+func (placement *Placement) validate() error {
+	switch placement.Position {
+	case "", PlacementFirst, PlacementLast:
+		return nil
+	case PlacementBefore, PlacementAfter:
+		if placement.Container == "" {
+			return fmt.Errorf("placement %s requires a container name", placement.Position)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid placement position %q, must be first, last, before, or after", placement.Position)
+	}
+}
+
+// placedContainers is a group of init containers and native sidecar containers from a single sidecar template
+type placedContainers struct {
+	sideCarName string
+	placement   Placement
+	containers  []corev1.Container
+}
+
+// addInitContainers creates patch operations which insert each group of containers into the init containers
+// according to its placement. Groups are inserted in order, and containers within a group remain together in
+// their original order. If a before or after container isn't found the group is appended to the end.
+func addInitContainers(target []corev1.Container, groups []placedContainers, basePath string, logger *zap.Logger) []patch.Operation {
+	var operations []patch.Operation
+
+	// Track the names of the init containers as they will be after each operation so indexes remain correct
+	names := make([]string, len(target))
+	for i := range target {
+		names[i] = target[i].Name
+	}
+
+	for _, group := range groups {
+		index := len(names)
+		switch group.placement.Position {
+		case PlacementFirst:
+			index = 0
+		case PlacementBefore, PlacementAfter:
+			if found := slices.Index(names, group.placement.Container); found >= 0 {
+				index = found
+				if group.placement.Position == PlacementAfter {
+					index++
+				}
+			} else {
+				logger.Info("Placement container not found, adding init containers last",
+					zap.String("sidecar", group.sideCarName),
+					zap.String("position", string(group.placement.Position)),
+					zap.String("container", group.placement.Container))
+			}
+		}
+
+		for _, container := range group.containers {
+			operations = append(operations, patch.InsertIntoList(len(names), index, container, basePath))
+			names = slices.Insert(names, index, container.Name)
+			index++
+		}
+	}
+
+	return operations
+}
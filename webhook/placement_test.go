@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestAddInitContainers(t *testing.T) {
+	type group struct {
+		placement  Placement
+		containers []string
+	}
+
+	tests := []struct {
+		name     string
+		existing []string
+		groups   []group
+		expected []string
+	}{
+		{
+			name:     "zero init containers",
+			existing: nil,
+			groups: []group{
+				{Placement{Position: PlacementFirst}, []string{"a1", "a2"}},
+				{Placement{}, []string{"b1"}},
+			},
+			expected: []string{"a1", "a2", "b1"},
+		},
+		{
+			name:     "zero init containers with missing before container",
+			existing: nil,
+			groups: []group{
+				{Placement{Position: PlacementBefore, Container: "missing"}, []string{"a1"}},
+				{Placement{Position: PlacementBefore, Container: "a1"}, []string{"b1"}},
+			},
+			expected: []string{"b1", "a1"},
+		},
+		{
+			name:     "one init container",
+			existing: []string{"init"},
+			groups: []group{
+				{Placement{Position: PlacementFirst}, []string{"a1"}},
+				{Placement{Position: PlacementAfter, Container: "init"}, []string{"b1", "b2"}},
+				{Placement{Position: PlacementBefore, Container: "init"}, []string{"c1"}},
+			},
+			expected: []string{"a1", "c1", "init", "b1", "b2"},
+		},
+		{
+			name:     "one init container last",
+			existing: []string{"init"},
+			groups: []group{
+				{Placement{Position: PlacementLast}, []string{"a1", "a2"}},
+			},
+			expected: []string{"init", "a1", "a2"},
+		},
+		{
+			name:     "many init containers",
+			existing: []string{"i1", "i2", "i3"},
+			groups: []group{
+				{Placement{Position: PlacementBefore, Container: "i2"}, []string{"a1", "a2"}},
+				{Placement{Position: PlacementAfter, Container: "i2"}, []string{"b1"}},
+				{Placement{Position: PlacementLast}, []string{"c1"}},
+				{Placement{Position: PlacementAfter, Container: "missing"}, []string{"d1"}},
+			},
+			expected: []string{"i1", "a1", "a2", "i2", "b1", "i3", "c1", "d1"},
+		},
+		{
+			name:     "many init containers with two templates before the same container",
+			existing: []string{"i1", "i2", "i3"},
+			groups: []group{
+				{Placement{Position: PlacementBefore, Container: "i2"}, []string{"a1"}},
+				{Placement{Position: PlacementBefore, Container: "i2"}, []string{"b1"}},
+				{Placement{Position: PlacementAfter, Container: "i3"}, []string{"c1"}},
+			},
+			expected: []string{"i1", "a1", "b1", "i2", "i3", "c1"},
+		},
+		{
+			name:     "many init containers placed relative to an injected container",
+			existing: []string{"i1", "i2"},
+			groups: []group{
+				{Placement{Position: PlacementFirst}, []string{"a1"}},
+				{Placement{Position: PlacementAfter, Container: "a1"}, []string{"b1"}},
+				{Placement{Position: PlacementBefore, Container: "missing"}, []string{"c1"}},
+			},
+			expected: []string{"a1", "b1", "i1", "i2", "c1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod := &corev1.Pod{}
+			for _, name := range test.existing {
+				pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{Name: name, Image: name})
+			}
+
+			var groups []placedContainers
+			for _, g := range test.groups {
+				placed := placedContainers{sideCarName: "test", placement: g.placement}
+				for _, name := range g.containers {
+					placed.containers = append(placed.containers, corev1.Container{Name: name, Image: name})
+				}
+				groups = append(groups, placed)
+			}
+
+			operations := addInitContainers(pod.Spec.InitContainers, groups, "/spec/initContainers", zap.NewNop())
+			patchBytes, err := json.Marshal(operations)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actual []string
+			for _, container := range applyPatch(t, pod, patchBytes).Spec.InitContainers {
+				actual = append(actual, container.Name)
+			}
+
+			if !slices.Equal(test.expected, actual) {
+				t.Errorf("expected init containers %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
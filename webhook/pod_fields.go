@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/CenterEdge/shawarma-webhook/patch"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// podFieldChanges collects the pod level fields from the sidecar templates to merge into the pod
+type podFieldChanges struct {
+	tolerations           []corev1.Toleration
+	shareProcessNamespace *bool
+	// The merged host aliases and DNS config, nil if unchanged
+	hostAliases []corev1.HostAlias
+	dnsConfig   *corev1.PodDNSConfig
+	labels      map[string]string
+	annotations map[string]string
+}
+
+func newPodFieldChanges() *podFieldChanges {
+	return &podFieldChanges{
+		labels:      make(map[string]string),
+		annotations: make(map[string]string),
+	}
+}
+
+// add merges the sidecar's pod level fields. Tolerations, host aliases, DNS nameservers and searches are added if not
+// already present. Host names are added to an existing host alias with the same IP. Conflicting values, such as a
+// label with a different value, fail unless the sidecar's collision strategy is skip or rename, in which case the
+// pod's value is kept.
+func (changes *podFieldChanges) add(pod *corev1.Pod, named *NamedSideCar, sideCar *SideCar, logger *zap.Logger) error {
+	strategy := named.CollisionStrategy
+	if strategy == "" {
+		strategy = CollisionFail
+	}
+
+	conflict := func(description string) error {
+		if strategy == CollisionFail {
+			return fmt.Errorf("sidecar %s %s", named.Name, description)
+		}
+
+		logger.Info("Skipping pod field which conflicts with the pod",
+			zap.String("sidecar", named.Name),
+			zap.String("reason", description))
+		return nil
+	}
+
+	for _, toleration := range sideCar.Tolerations {
+		isSame := func(t corev1.Toleration) bool { return equality.Semantic.DeepEqual(t, toleration) }
+		if !slices.ContainsFunc(pod.Spec.Tolerations, isSame) && !slices.ContainsFunc(changes.tolerations, isSame) {
+			changes.tolerations = append(changes.tolerations, toleration)
+		}
+	}
+
+	if sideCar.ShareProcessNamespace != nil {
+		current := pod.Spec.ShareProcessNamespace
+		if changes.shareProcessNamespace != nil {
+			current = changes.shareProcessNamespace
+		}
+
+		if current == nil {
+			value := *sideCar.ShareProcessNamespace
+			changes.shareProcessNamespace = &value
+		} else if *current != *sideCar.ShareProcessNamespace {
+			if err := conflict(fmt.Sprintf("shareProcessNamespace %t conflicts with the pod", *sideCar.ShareProcessNamespace)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(sideCar.HostAliases) > 0 {
+		hostAliases := changes.hostAliases
+		if hostAliases == nil {
+			hostAliases = slices.Clone(pod.Spec.HostAliases)
+		}
+
+		changed := false
+		for _, alias := range sideCar.HostAliases {
+			existing := slices.IndexFunc(hostAliases, func(a corev1.HostAlias) bool { return a.IP == alias.IP })
+			if existing < 0 {
+				hostAliases = append(hostAliases, *alias.DeepCopy())
+				changed = true
+				continue
+			}
+
+			for _, hostname := range alias.Hostnames {
+				if !slices.Contains(hostAliases[existing].Hostnames, hostname) {
+					// Copy before appending so the pod's host alias isn't modified
+					hostAliases[existing].Hostnames = append(slices.Clone(hostAliases[existing].Hostnames), hostname)
+					changed = true
+				}
+			}
+		}
+
+		if changed {
+			changes.hostAliases = hostAliases
+		}
+	}
+
+	if sideCar.DNSConfig != nil {
+		dnsConfig := changes.dnsConfig
+		if dnsConfig == nil {
+			dnsConfig = pod.Spec.DNSConfig.DeepCopy()
+			if dnsConfig == nil {
+				dnsConfig = &corev1.PodDNSConfig{}
+			}
+		}
+
+		changed := false
+		for _, nameserver := range sideCar.DNSConfig.Nameservers {
+			if !slices.Contains(dnsConfig.Nameservers, nameserver) {
+				dnsConfig.Nameservers = append(dnsConfig.Nameservers, nameserver)
+				changed = true
+			}
+		}
+		for _, search := range sideCar.DNSConfig.Searches {
+			if !slices.Contains(dnsConfig.Searches, search) {
+				dnsConfig.Searches = append(dnsConfig.Searches, search)
+				changed = true
+			}
+		}
+		for _, option := range sideCar.DNSConfig.Options {
+			existing := slices.IndexFunc(dnsConfig.Options, func(o corev1.PodDNSConfigOption) bool { return o.Name == option.Name })
+			if existing < 0 {
+				dnsConfig.Options = append(dnsConfig.Options, *option.DeepCopy())
+				changed = true
+			} else if !equality.Semantic.DeepEqual(dnsConfig.Options[existing], option) {
+				if err := conflict(fmt.Sprintf("DNS option %s conflicts with the pod", option.Name)); err != nil {
+					return err
+				}
+			}
+		}
+
+		if changed {
+			changes.dnsConfig = dnsConfig
+		}
+	}
+
+	if err := mergeStringMap(changes.labels, pod.Labels, sideCar.Labels, "label", conflict); err != nil {
+		return err
+	}
+
+	return mergeStringMap(changes.annotations, pod.Annotations, sideCar.Annotations, "annotation", conflict)
+}
+
+// mergeStringMap adds values which aren't already present in the pod or the pending changes
+func mergeStringMap(pending map[string]string, existing map[string]string, added map[string]string, description string, conflict func(string) error) error {
+	for key, value := range added {
+		current, ok := existing[key]
+		if !ok {
+			current, ok = pending[key]
+		}
+
+		if !ok {
+			pending[key] = value
+		} else if current != value {
+			if err := conflict(fmt.Sprintf("%s %s conflicts with the pod", description, key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// createPatch returns the patch operations to apply the changes, except annotations which must be merged with
+// the other annotations added to the pod
+func (changes *podFieldChanges) createPatch(pod *corev1.Pod) []patch.Operation {
+	var operations []patch.Operation
+
+	operations = append(operations, patch.AppendToList(pod.Spec.Tolerations, changes.tolerations, "/spec/tolerations")...)
+
+	if changes.shareProcessNamespace != nil {
+		operations = append(operations, patch.Add("/spec/shareProcessNamespace", *changes.shareProcessNamespace))
+	}
+
+	// Adding an existing object member replaces it, so the merged values replace any existing values
+	if changes.hostAliases != nil {
+		operations = append(operations, patch.Add("/spec/hostAliases", changes.hostAliases))
+	}
+
+	if changes.dnsConfig != nil {
+		operations = append(operations, patch.Add("/spec/dnsConfig", changes.dnsConfig))
+	}
+
+	operations = append(operations, patch.UpdateMap(pod.Labels, changes.labels, "/metadata/labels")...)
+
+	return operations
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/CenterEdge/shawarma-webhook/patch"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+/*PodPatch is an additional patch applied to the pod after the sidecar template is injected*/
+type PodPatch struct {
+	// JSONPatch is a list of RFC 6902 operations
+	JSONPatch json.RawMessage `json:"jsonPatch,omitempty"`
+	// StrategicMerge is a strategic merge patch of the pod, applied after the JSONPatch
+	StrategicMerge json.RawMessage `json:"strategicMerge,omitempty"`
+}
+
+func (podPatch *PodPatch) validate() error {
+	if podPatch == nil {
+		return nil
+	}
+
+	if len(podPatch.JSONPatch) > 0 {
+		if _, err := jsonpatch.DecodePatch(podPatch.JSONPatch); err != nil {
+			return fmt.Errorf("invalid jsonPatch: %w", err)
+		}
+	}
+
+	if len(podPatch.StrategicMerge) > 0 {
+		var fragment map[string]any
+		if err := json.Unmarshal(podPatch.StrategicMerge, &fragment); err != nil {
+			return fmt.Errorf("invalid strategicMerge, must be an object: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// namedPodPatch is the pod patch of a single sidecar template
+type namedPodPatch struct {
+	sideCarName string
+	podPatch    *PodPatch
+}
+
+// applyPodPatches applies the templates' pod patches to the pod after the patch operations, and returns the patch
+// operations with additional operations which produce the same result. The patched pod must be a valid pod with
+// the same identity.
+func applyPodPatches(pod *corev1.Pod, operations []patch.Operation, podPatches []namedPodPatch) ([]patch.Operation, error) {
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	document := original
+	if len(operations) > 0 {
+		patchBytes, err := json.Marshal(operations)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, err := jsonpatch.DecodePatch(patchBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		if document, err = decoded.Apply(document); err != nil {
+			return nil, fmt.Errorf("failed to apply sidecar patch: %w", err)
+		}
+	}
+	injected := document
+
+	for _, named := range podPatches {
+		name, podPatch := named.sideCarName, named.podPatch
+
+		if len(podPatch.JSONPatch) > 0 {
+			decoded, err := jsonpatch.DecodePatch(podPatch.JSONPatch)
+			if err != nil {
+				return nil, fmt.Errorf("invalid jsonPatch in sidecar template %q: %w", name, err)
+			}
+
+			if document, err = decoded.Apply(document); err != nil {
+				return nil, fmt.Errorf("failed to apply jsonPatch in sidecar template %q: %w", name, err)
+			}
+		}
+
+		if len(podPatch.StrategicMerge) > 0 {
+			if document, err = strategicpatch.StrategicMergePatch(document, podPatch.StrategicMerge, corev1.Pod{}); err != nil {
+				return nil, fmt.Errorf("failed to apply strategicMerge in sidecar template %q: %w", name, err)
+			}
+		}
+	}
+
+	if err := validatePatchedPod(pod, document); err != nil {
+		return nil, fmt.Errorf("invalid pod after applying sidecar pod patches: %w", err)
+	}
+
+	var before, after any
+	if err := unmarshalJSONValue(injected, &before); err != nil {
+		return nil, err
+	}
+	if err := unmarshalJSONValue(document, &after); err != nil {
+		return nil, err
+	}
+
+	return append(operations, patch.Diff(before, after)...), nil
+}
+
+// validatePatchedPod ensures the document is a pod without unknown fields, and that the identity of the pod is unchanged
+func validatePatchedPod(pod *corev1.Pod, document []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+
+	var patched corev1.Pod
+	if err := decoder.Decode(&patched); err != nil {
+		return err
+	}
+
+	if patched.Name != pod.Name || patched.GenerateName != pod.GenerateName || patched.Namespace != pod.Namespace {
+		return fmt.Errorf("the pod name and namespace may not be changed")
+	}
+
+	return nil
+}
+
+func unmarshalJSONValue(data []byte, value *any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers exact, so large integers are compared and written unchanged
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// registryMirror replaces a registry, or a repository prefix within a registry, with a mirror
+type registryMirror struct {
+	source string
+	mirror string
+}
+
+// registryMirrors are sorted with the longest source first, so the most specific mirror is used
+type registryMirrors []registryMirror
+
+func newRegistryMirrors(mirrors map[string]string) (registryMirrors, error) {
+	result := make(registryMirrors, 0, len(mirrors))
+	for source, mirror := range mirrors {
+		source = strings.TrimSuffix(strings.TrimSpace(source), "/")
+		mirror = strings.TrimSuffix(strings.TrimSpace(mirror), "/")
+		if source == "" || mirror == "" {
+			return nil, fmt.Errorf("invalid registry mirror %q: %q, source and mirror are required", source, mirror)
+		}
+		if strings.Contains(source, "://") || strings.Contains(mirror, "://") {
+			return nil, fmt.Errorf("invalid registry mirror %q: %q, must not include a scheme", source, mirror)
+		}
+
+		result = append(result, registryMirror{source: source, mirror: mirror})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].source) != len(result[j].source) {
+			return len(result[i].source) > len(result[j].source)
+		}
+		return result[i].source < result[j].source
+	})
+
+	return result, nil
+}
+
+// rewrite replaces the registry of the image with its mirror. The source must match the fully qualified name of
+// the image, such as docker.io/library/nginx, up to a path separator. Returns false if no mirror applies.
+func (mirrors registryMirrors) rewrite(image string) (string, bool, error) {
+	if len(mirrors) == 0 {
+		return image, false, nil
+	}
+
+	reference, err := parseImageReference(image)
+	if err != nil {
+		return image, false, err
+	}
+
+	name := reference.Name()
+	for _, mirror := range mirrors {
+		if name == mirror.source || strings.HasPrefix(name, mirror.source+"/") {
+			return mirror.mirror + strings.TrimPrefix(reference.String(), mirror.source), true, nil
+		}
+	}
+
+	return image, false, nil
+}
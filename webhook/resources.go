@@ -0,0 +1,182 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*ResourceBoundsAction determines how resource overrides outside of the bounds are handled*/
+type ResourceBoundsAction string
+
+const (
+	// ResourceBoundsClamp raises or lowers the override to the nearest bound
+	ResourceBoundsClamp ResourceBoundsAction = "clamp"
+	// ResourceBoundsReject rejects the pod with a descriptive error
+	ResourceBoundsReject ResourceBoundsAction = "reject"
+)
+
+/*ResourceBounds limits the resources which may be requested by pod annotations*/
+type ResourceBounds struct {
+	Action ResourceBoundsAction `json:"action,omitempty"`
+	Min    corev1.ResourceList  `json:"min,omitempty"`
+	Max    corev1.ResourceList  `json:"max,omitempty"`
+}
+
+// resourceOverrideAnnotations are the annotations which override the resources of injected containers
+var resourceOverrideAnnotations = []struct {
+	annotation   string
+	resourceName corev1.ResourceName
+	limit        bool
+}{
+	{sideCarCPURequestAnnotation, corev1.ResourceCPU, false},
+	{sideCarCPULimitAnnotation, corev1.ResourceCPU, true},
+	{sideCarMemoryRequestAnnotation, corev1.ResourceMemory, false},
+	{sideCarMemoryLimitAnnotation, corev1.ResourceMemory, true},
+}
+
+// resourceOverrides are the requests and limits to apply to injected containers
+type resourceOverrides struct {
+	requests corev1.ResourceList
+	limits   corev1.ResourceList
+}
+
+func (bounds *ResourceBounds) validate() error {
+	if bounds == nil {
+		return nil
+	}
+
+	switch bounds.Action {
+	case "", ResourceBoundsClamp, ResourceBoundsReject:
+	default:
+		return fmt.Errorf("invalid resource bounds action %q, must be clamp or reject", bounds.Action)
+	}
+
+	for _, list := range []corev1.ResourceList{bounds.Min, bounds.Max} {
+		for name := range list {
+			if name != corev1.ResourceCPU && name != corev1.ResourceMemory {
+				return fmt.Errorf("invalid resource bounds for %s, only cpu and memory are supported", name)
+			}
+		}
+	}
+
+	for name, min := range bounds.Min {
+		if max, ok := bounds.Max[name]; ok && min.Cmp(max) > 0 {
+			return fmt.Errorf("invalid resource bounds for %s, min %s is greater than max %s", name, min.String(), max.String())
+		}
+	}
+
+	return nil
+}
+
+// getResourceOverrides parses the pod's resource annotations and applies the bounds, returns nil if there are no overrides
+func getResourceOverrides(metadata *metav1.ObjectMeta, bounds *ResourceBounds, logger *zap.Logger) (*resourceOverrides, error) {
+	var overrides *resourceOverrides
+
+	for _, override := range resourceOverrideAnnotations {
+		value, ok := metadata.GetAnnotations()[override.annotation]
+		if !ok {
+			continue
+		}
+
+		quantity, err := resource.ParseQuantity(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for annotation %s: %w", value, override.annotation, err)
+		}
+
+		if quantity, err = bounds.apply(override.annotation, override.resourceName, quantity, logger); err != nil {
+			return nil, err
+		}
+
+		if overrides == nil {
+			overrides = &resourceOverrides{
+				requests: corev1.ResourceList{},
+				limits:   corev1.ResourceList{},
+			}
+		}
+		if override.limit {
+			overrides.limits[override.resourceName] = quantity
+		} else {
+			overrides.requests[override.resourceName] = quantity
+		}
+	}
+
+	return overrides, nil
+}
+
+// apply clamps the quantity to the bounds, or returns an error if the quantity is out of bounds and the action is reject
+func (bounds *ResourceBounds) apply(annotation string, name corev1.ResourceName, quantity resource.Quantity, logger *zap.Logger) (resource.Quantity, error) {
+	if bounds == nil {
+		return quantity, nil
+	}
+
+	bound, description := quantity, ""
+	if min, ok := bounds.Min[name]; ok && quantity.Cmp(min) < 0 {
+		bound, description = min, "minimum"
+	} else if max, ok := bounds.Max[name]; ok && quantity.Cmp(max) > 0 {
+		bound, description = max, "maximum"
+	}
+
+	if description == "" {
+		return quantity, nil
+	}
+
+	if bounds.Action == ResourceBoundsReject {
+		return quantity, fmt.Errorf("value %s for annotation %s is outside of the %s %s", quantity.String(), annotation, description, bound.String())
+	}
+
+	logger.Info("Clamping resource override to bounds",
+		zap.String("annotation", annotation),
+		zap.String("value", quantity.String()),
+		zap.String(description, bound.String()))
+	return bound, nil
+}
+
+// applyResourceOverrides replaces the requests and limits of the sidecar's containers, raising template limits which
+// are below an overridden request. Returns an error if a request would exceed an overridden limit.
+func (in *SideCar) applyResourceOverrides(overrides *resourceOverrides) error {
+	if overrides == nil {
+		return nil
+	}
+
+	for i := range in.Containers {
+		container := &in.Containers[i]
+
+		if len(overrides.requests) > 0 && container.Resources.Requests == nil {
+			container.Resources.Requests = corev1.ResourceList{}
+		}
+		for name, quantity := range overrides.requests {
+			container.Resources.Requests[name] = quantity
+		}
+
+		if len(overrides.limits) > 0 && container.Resources.Limits == nil {
+			container.Resources.Limits = corev1.ResourceList{}
+		}
+		for name, quantity := range overrides.limits {
+			container.Resources.Limits[name] = quantity
+		}
+
+		// A request above the template's limit raises the limit unless the limit is also overridden. The request
+		// is already within the bounds, so the raised limit is as well.
+		for name, quantity := range overrides.requests {
+			if _, ok := overrides.limits[name]; ok {
+				continue
+			}
+			if limit, ok := container.Resources.Limits[name]; ok && quantity.Cmp(limit) > 0 {
+				container.Resources.Limits[name] = quantity
+			}
+		}
+
+		for name, request := range container.Resources.Requests {
+			if limit, ok := container.Resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+				return fmt.Errorf("container %s %s request %s is greater than the limit %s", container.Name, name, request.String(), limit.String())
+			}
+		}
+	}
+
+	return nil
+}
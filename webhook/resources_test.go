@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestResourceOverrides(t *testing.T) {
+	// Requests equal to limits, like the default sidecar configuration
+	const config = `
+sidecars:
+- name: shawarma
+  sidecar:
+    containers:
+    - name: shawarma
+      image: "|SHAWARMA_IMAGE|"
+      resources:
+        requests:
+          cpu: 25m
+          memory: 64Mi
+        limits:
+          cpu: 25m
+          memory: 64Mi
+`
+
+	tests := []struct {
+		name        string
+		bounds      string
+		annotations map[string]string
+		requests    map[corev1.ResourceName]string
+		limits      map[corev1.ResourceName]string
+		err         string
+	}{
+		{
+			name:        "request only raises the limit",
+			annotations: map[string]string{sideCarCPURequestAnnotation: "100m"},
+			requests:    map[corev1.ResourceName]string{corev1.ResourceCPU: "100m", corev1.ResourceMemory: "64Mi"},
+			limits:      map[corev1.ResourceName]string{corev1.ResourceCPU: "100m", corev1.ResourceMemory: "64Mi"},
+		},
+		{
+			name:        "request only below the limit",
+			annotations: map[string]string{sideCarMemoryRequestAnnotation: "32Mi"},
+			requests:    map[corev1.ResourceName]string{corev1.ResourceCPU: "25m", corev1.ResourceMemory: "32Mi"},
+			limits:      map[corev1.ResourceName]string{corev1.ResourceCPU: "25m", corev1.ResourceMemory: "64Mi"},
+		},
+		{
+			name:        "request only clamped to max",
+			bounds:      "resourceBounds:\n  max:\n    cpu: 50m\n",
+			annotations: map[string]string{sideCarCPURequestAnnotation: "100m"},
+			requests:    map[corev1.ResourceName]string{corev1.ResourceCPU: "50m", corev1.ResourceMemory: "64Mi"},
+			limits:      map[corev1.ResourceName]string{corev1.ResourceCPU: "50m", corev1.ResourceMemory: "64Mi"},
+		},
+		{
+			name:        "request only rejected above max",
+			bounds:      "resourceBounds:\n  action: reject\n  max:\n    cpu: 50m\n",
+			annotations: map[string]string{sideCarCPURequestAnnotation: "100m"},
+			err:         "is outside of the maximum 50m",
+		},
+		{
+			name: "request and limit",
+			annotations: map[string]string{
+				sideCarCPURequestAnnotation: "100m",
+				sideCarCPULimitAnnotation:   "200m",
+			},
+			requests: map[corev1.ResourceName]string{corev1.ResourceCPU: "100m", corev1.ResourceMemory: "64Mi"},
+			limits:   map[corev1.ResourceName]string{corev1.ResourceCPU: "200m", corev1.ResourceMemory: "64Mi"},
+		},
+		{
+			name: "request greater than the overridden limit",
+			annotations: map[string]string{
+				sideCarCPURequestAnnotation: "100m",
+				sideCarCPULimitAnnotation:   "50m",
+			},
+			err: "cpu request 100m is greater than the limit 50m",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mutator := newTestMutator(t, test.bounds+config)
+			annotations := map[string]string{sideCarInjectionAnnotation: "test"}
+			for key, value := range test.annotations {
+				annotations[key] = value
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: annotations},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app", Image: "app"}},
+				},
+			}
+
+			if test.err != "" {
+				raw, err := json.Marshal(pod)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				response := mutate(&v1.AdmissionRequest{Namespace: "default", Object: runtime.RawExtension{Raw: raw}}, mutator)
+				if response.Allowed || !strings.Contains(response.Result.Message, test.err) {
+					t.Fatalf("expected rejection containing %q, got %+v", test.err, response.Result)
+				}
+				return
+			}
+
+			patched, _ := mutatePod(t, mutator, pod)
+			if len(patched.Spec.Containers) != 2 {
+				t.Fatalf("expected the sidecar to be injected, got %d containers", len(patched.Spec.Containers))
+			}
+
+			resources := patched.Spec.Containers[1].Resources
+			assertResources(t, "request", resources.Requests, test.requests)
+			assertResources(t, "limit", resources.Limits, test.limits)
+		})
+	}
+}
+
+func assertResources(t *testing.T, description string, actual corev1.ResourceList, expected map[corev1.ResourceName]string) {
+	t.Helper()
+
+	if len(actual) != len(expected) {
+		t.Errorf("expected %d %ss, got %v", len(expected), description, actual)
+	}
+	for name, value := range expected {
+		if quantity, ok := actual[name]; !ok || quantity.Cmp(resource.MustParse(value)) != 0 {
+			t.Errorf("expected %s %s %s, got %s", name, description, value, quantity.String())
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"fmt"
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const bareOwnerKind = "Pod"
+
+/*MatchRule selects pods which receive a sidecar without requiring Shawarma annotations*/
+type MatchRule struct {
+	LabelSelector     *metav1.LabelSelector `json:"labelSelector,omitempty"`
+	Namespaces        []string              `json:"namespaces,omitempty"`
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	OwnerKinds        []string              `json:"ownerKinds,omitempty"`
+	ServiceNameLabel  string                `json:"serviceNameLabel,omitempty"`
+
+	selector          labels.Selector
+	namespaces        *patternMatcher
+	namespaceSelector labels.Selector
+}
+
+func (rule *MatchRule) compile() error {
+	if rule.LabelSelector == nil && len(rule.Namespaces) == 0 && rule.NamespaceSelector == nil && len(rule.OwnerKinds) == 0 &&
+		rule.ServiceNameLabel == "" {
+		return fmt.Errorf("match rule must have at least one condition")
+	}
+
+	rule.selector = labels.Everything()
+	if rule.LabelSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(rule.LabelSelector)
+		if err != nil {
+			return fmt.Errorf("invalid label selector: %w", err)
+		}
+		rule.selector = selector
+	}
+
+	namespaces, err := newPatternMatcher(rule.Namespaces)
+	if err != nil {
+		return err
+	}
+	rule.namespaces = namespaces
+
+	if rule.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(rule.NamespaceSelector)
+		if err != nil {
+			return fmt.Errorf("invalid namespace selector: %w", err)
+		}
+		rule.namespaceSelector = selector
+	}
+
+	return nil
+}
+
+// matches returns true if the pod matches all conditions of the rule, along with the service name
+// derived from the pod labels, if any. The namespace labels are only read if the rule has a namespace selector.
+func (rule *MatchRule) matches(metadata *metav1.ObjectMeta, namespace string, namespaceLabels func() (labels.Set, bool)) (string, bool) {
+	if !rule.selector.Matches(labels.Set(metadata.GetLabels())) {
+		return "", false
+	}
+
+	if !rule.namespaces.isEmpty() {
+		if _, ok := rule.namespaces.match(namespace); !ok {
+			return "", false
+		}
+	}
+
+	if rule.namespaceSelector != nil {
+		if values, ok := namespaceLabels(); !ok || !rule.namespaceSelector.Matches(values) {
+			return "", false
+		}
+	}
+
+	if len(rule.OwnerKinds) > 0 && !slices.Contains(rule.OwnerKinds, getOwnerKind(metadata)) {
+		return "", false
+	}
+
+	if rule.ServiceNameLabel != "" {
+		serviceName := metadata.GetLabels()[rule.ServiceNameLabel]
+		if serviceName == "" {
+			// The sidecar can't function without a service
+			return "", false
+		}
+
+		return serviceName, true
+	}
+
+	return "", true
+}
+
+// matchRules returns the names of all sidecars, in configuration order, with a rule that matches the pod,
+// along with the service name derived from the first matching rule which provides one.
+func (config *SideCarConfig) matchRules(metadata *metav1.ObjectMeta, namespace string, namespaceLabels func() (labels.Set, bool)) ([]string, string) {
+	var names []string
+	var serviceName string
+	for _, name := range config.Order {
+		for i := range config.SideCars[name].Match {
+			if ruleServiceName, ok := config.SideCars[name].Match[i].matches(metadata, namespace, namespaceLabels); ok {
+				names = append(names, name)
+				if serviceName == "" {
+					serviceName = ruleServiceName
+				}
+				break
+			}
+		}
+	}
+
+	return names, serviceName
+}
+
+// getOwnerKind returns the kind of the controller which owns the pod, or Pod for bare pods
+func getOwnerKind(metadata *metav1.ObjectMeta) string {
+	if owner := metav1.GetControllerOfNoCopy(metadata); owner != nil {
+		return owner.Kind
+	}
+
+	return bareOwnerKind
+}
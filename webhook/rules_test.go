@@ -0,0 +1,80 @@
+package webhook
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestMatchRuleNamespaceSelector(t *testing.T) {
+	rule := MatchRule{
+		Namespaces: []string{"team-*"},
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"monitoring": "shawarma"},
+		},
+	}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		namespace       string
+		namespaceLabels labels.Set
+		known           bool
+		expected        bool
+	}{
+		{
+			name:            "matching labels",
+			namespace:       "team-a",
+			namespaceLabels: labels.Set{"monitoring": "shawarma"},
+			known:           true,
+			expected:        true,
+		},
+		{
+			name:            "other labels",
+			namespace:       "team-a",
+			namespaceLabels: labels.Set{"monitoring": "other"},
+			known:           true,
+		},
+		{
+			name:            "unmatched namespace name",
+			namespace:       "other",
+			namespaceLabels: labels.Set{"monitoring": "shawarma"},
+			known:           true,
+		},
+		{
+			name:      "unknown labels",
+			namespace: "team-a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			namespaceLabels := func() (labels.Set, bool) {
+				return test.namespaceLabels, test.known
+			}
+
+			if _, ok := rule.matches(&metav1.ObjectMeta{}, test.namespace, namespaceLabels); ok != test.expected {
+				t.Errorf("expected match %v, got %v", test.expected, ok)
+			}
+		})
+	}
+}
+
+func TestMatchRuleWithoutNamespaceSelector(t *testing.T) {
+	rule := MatchRule{OwnerKinds: []string{bareOwnerKind}}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	namespaceLabels := func() (labels.Set, bool) {
+		t.Error("namespace labels should only be read for rules with a namespace selector")
+		return nil, false
+	}
+
+	if _, ok := rule.matches(&metav1.ObjectMeta{}, "default", namespaceLabels); !ok {
+		t.Error("expected the rule to match")
+	}
+}
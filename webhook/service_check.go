@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+/*ServiceCheckMode determines how pods referencing a missing Service are handled*/
+type ServiceCheckMode string
+
+const (
+	// ServiceCheckOff doesn't check that the Service exists
+	ServiceCheckOff ServiceCheckMode = "off"
+	// ServiceCheckWarn returns a warning if the Service doesn't exist
+	ServiceCheckWarn ServiceCheckMode = "warn"
+	// ServiceCheckDeny rejects the pod if the Service doesn't exist
+	ServiceCheckDeny ServiceCheckMode = "deny"
+)
+
+/*ParseServiceCheckMode parses off, warn, or deny*/
+func ParseServiceCheckMode(value string) (ServiceCheckMode, error) {
+	switch mode := ServiceCheckMode(strings.ToLower(value)); mode {
+	case "", ServiceCheckOff:
+		return ServiceCheckOff, nil
+	case ServiceCheckWarn, ServiceCheckDeny:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid service check mode %q, must be off, warn, or deny", value)
+	}
+}
+
+// ServiceMonitor keeps a cache of the Services in the cluster using an informer
+type ServiceMonitor struct {
+	informer cache.SharedIndexInformer
+	lister   corev1listers.ServiceLister
+	stop     chan struct{}
+	logger   *zap.Logger
+}
+
+// NewServiceMonitor creates a monitor for all Services, the Kubernetes client must be initialized
+func NewServiceMonitor(resync time.Duration, logger *zap.Logger) (*ServiceMonitor, error) {
+	if k8sClient == nil {
+		return nil, fmt.Errorf("kubernetes client is not initialized")
+	}
+
+	services := informers.NewSharedInformerFactory(k8sClient, resync).Core().V1().Services()
+
+	return &ServiceMonitor{
+		informer: services.Informer(),
+		lister:   services.Lister(),
+		stop:     make(chan struct{}),
+		logger:   logger,
+	}, nil
+}
+
+// Start the monitor, the cache is filled in the background
+func (monitor *ServiceMonitor) Start() {
+	go monitor.informer.Run(monitor.stop)
+
+	go func() {
+		if cache.WaitForCacheSync(monitor.stop, monitor.informer.HasSynced) {
+			monitor.logger.Info("Service cache synced")
+		}
+	}()
+}
+
+// Stop the monitor
+func (monitor *ServiceMonitor) Stop() {
+	close(monitor.stop)
+}
+
+// HasSynced returns true once the initial list of Services has been received
+func (monitor *ServiceMonitor) HasSynced() bool {
+	return monitor.informer.HasSynced()
+}
+
+// check returns an error if the named Service doesn't exist, or if no Service matches the labels
+func (monitor *ServiceMonitor) check(namespace string, serviceName string, serviceLabels string) error {
+	if serviceName != "" {
+		if _, err := monitor.lister.Services(namespace).Get(serviceName); err != nil {
+			if apierrors.IsNotFound(err) {
+				return fmt.Errorf("service %s referenced by annotation %s does not exist in namespace %s",
+					serviceName, sideCarInjectionAnnotation, namespace)
+			}
+			return err
+		}
+	}
+
+	if serviceLabels != "" {
+		selector, err := labels.Parse(serviceLabels)
+		if err != nil {
+			return fmt.Errorf("invalid annotation %s: %w", sideCarLabelInjectionAnnotation, err)
+		}
+
+		services, err := monitor.lister.Services(namespace).List(selector)
+		if err != nil {
+			return err
+		}
+
+		if len(services) == 0 {
+			return fmt.Errorf("no service in namespace %s matches labels %s from annotation %s",
+				namespace, serviceLabels, sideCarLabelInjectionAnnotation)
+		}
+	}
+
+	return nil
+}
+
+// checkService verifies that the Service monitored by the injected sidecar exists, returns nil if the check is
+// disabled or the Service cache isn't yet synced
+func (mutator *Mutator) checkService(annotations map[string]string, namespace string, injection *injection, logger *zap.Logger) error {
+	if mutator.serviceMonitor == nil {
+		return nil
+	}
+
+	if !mutator.serviceMonitor.HasSynced() {
+		logger.Warn("Service cache is not yet synced, skipping service check")
+		return nil
+	}
+
+	// Match rules pass the service name using an annotation added during injection
+	serviceName := injection.annotations[sideCarInjectionAnnotation]
+	if serviceName == "" {
+		serviceName = annotations[sideCarInjectionAnnotation]
+	}
+
+	return mutator.serviceMonitor.check(namespace, serviceName, annotations[sideCarLabelInjectionAnnotation])
+}
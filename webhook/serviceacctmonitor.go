@@ -6,8 +6,6 @@ import (
 	"go.uber.org/zap"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 )
 
@@ -22,10 +20,6 @@ type ServiceAcctMonitor struct {
 	logger             *zap.Logger
 }
 
-var (
-	k8sClient *kubernetes.Clientset
-)
-
 // NewServiceAcctMonitor Create a new service account monitor
 func NewServiceAcctMonitor(namespace string, serviceAccountName string, logger *zap.Logger) (*ServiceAcctMonitor, error) {
 	monitor := ServiceAcctMonitor{
@@ -141,22 +135,5 @@ func (monitor *ServiceAcctMonitor) updateSecretName(secretName string) {
 
 // InitializeServiceAcctMonitor with Kubernetes configuration
 func InitializeServiceAcctMonitor() error {
-	if k8sClient != nil {
-		return nil
-	}
-
-	// creates the in-cluster config
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return err
-	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return err
-	}
-
-	k8sClient = clientset
-
-	return nil
+	return InitializeKubernetesClient()
 }
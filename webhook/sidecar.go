@@ -1,7 +1,10 @@
 package webhook
 
 import (
+	"fmt"
+	"maps"
 	"os"
+	"text/template"
 
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
@@ -10,13 +13,46 @@ import (
 
 /*sideCars is an array of named SideCar instances*/
 type SideCars struct {
-	Sidecars []NamedSideCar `json:"sidecars,omitempty"`
+	IgnoreNamespaces []string             `json:"ignoreNamespaces,omitempty"`
+	OnlyNamespaces   []string             `json:"onlyNamespaces,omitempty"`
+	Tokens           []Token              `json:"tokens,omitempty"`
+	ResourceBounds   *ResourceBounds      `json:"resourceBounds,omitempty"`
+	ImageOverride    *ImageOverridePolicy `json:"imageOverride,omitempty"`
+	RegistryMirrors  map[string]string    `json:"registryMirrors,omitempty"`
+	Sidecars         []NamedSideCar       `json:"sidecars,omitempty"`
+}
+
+/*Token is a custom |NAME| replacement token which may be used in any string field of a SideCar*/
+type Token struct {
+	Name       string `json:"name"`
+	Default    string `json:"default,omitempty"`
+	Env        string `json:"env,omitempty"`
+	Annotation string `json:"annotation,omitempty"`
+}
+
+/*SideCarConfig is the loaded sidecar configuration file*/
+type SideCarConfig struct {
+	SideCars       map[string]*NamedSideCar
+	Order          []string
+	Tokens         []Token
+	ResourceBounds *ResourceBounds
+	ImageOverride  *ImageOverridePolicy
+
+	ignoreNamespaces *patternMatcher
+	onlyNamespaces   *patternMatcher
+	registryMirrors  registryMirrors
 }
 
 /*namedSideCar is a named sidecar to be injected*/
 type NamedSideCar struct {
-	Name    string  `json:"name"`
-	Sidecar SideCar `json:"sidecar"`
+	Name              string                       `json:"name"`
+	Match             []MatchRule                  `json:"match,omitempty"`
+	OwnerPolicy       map[string]OwnerPolicyAction `json:"ownerPolicy,omitempty"`
+	CollisionStrategy CollisionStrategy            `json:"collisionStrategy,omitempty"`
+	RenameSuffix      string                       `json:"renameSuffix,omitempty"`
+	Placement         Placement                    `json:"placement,omitempty"`
+	PodPatch          *PodPatch                    `json:"podPatch,omitempty"`
+	Sidecar           SideCar                      `json:"sidecar"`
 }
 
 /*SideCar is the template of the sidecar to be implemented*/
@@ -24,9 +60,26 @@ type SideCar struct {
 	Containers       []corev1.Container            `json:"containers,omitempty"`
 	Volumes          []corev1.Volume               `json:"volumes,omitempty"`
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Environment variables and volume mounts added to the pod's existing containers, optionally filtered by name
+	AppContainerNames        []string             `json:"appContainerNames,omitempty"`
+	AppContainerEnv          []corev1.EnvVar      `json:"appContainerEnv,omitempty"`
+	AppContainerVolumeMounts []corev1.VolumeMount `json:"appContainerVolumeMounts,omitempty"`
+
+	// Pod level fields which are merged into the pod
+	InitContainers        []corev1.Container   `json:"initContainers,omitempty"`
+	Tolerations           []corev1.Toleration  `json:"tolerations,omitempty"`
+	ShareProcessNamespace *bool                `json:"shareProcessNamespace,omitempty"`
+	HostAliases           []corev1.HostAlias   `json:"hostAliases,omitempty"`
+	DNSConfig             *corev1.PodDNSConfig `json:"dnsConfig,omitempty"`
+	Labels                map[string]string    `json:"labels,omitempty"`
+	Annotations           map[string]string    `json:"annotations,omitempty"`
+
+	// Pre-parsed Go templates found in string fields, keyed by the original string
+	templates map[string]*template.Template
 }
 
-func LoadSideCars(sideCarConfigFile string, logger *zap.Logger) (map[string]*SideCar, error) {
+func LoadSideCars(sideCarConfigFile string, logger *zap.Logger) (*SideCarConfig, error) {
 	data, err := os.ReadFile(sideCarConfigFile)
 	if err != nil {
 		return nil, err
@@ -39,12 +92,81 @@ func LoadSideCars(sideCarConfigFile string, logger *zap.Logger) (map[string]*Sid
 		return nil, err
 	}
 
-	mapOfSideCar := make(map[string]*SideCar, len(cfg.Sidecars))
+	if err := validateTokens(cfg.Tokens); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ResourceBounds.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.ImageOverride.compile(); err != nil {
+		return nil, err
+	}
+
+	registryMirrors, err := newRegistryMirrors(cfg.RegistryMirrors)
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreNamespaces, err := newPatternMatcher(cfg.IgnoreNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	onlyNamespaces, err := newPatternMatcher(cfg.OnlyNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	mapOfSideCar := make(map[string]*NamedSideCar, len(cfg.Sidecars))
+	order := make([]string, 0, len(cfg.Sidecars))
 	for _, configuration := range cfg.Sidecars {
-		mapOfSideCar[configuration.Name] = &configuration.Sidecar
+		templates, err := parseTemplates(configuration.Name, &configuration.Sidecar)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateOwnerPolicy(configuration.OwnerPolicy); err != nil {
+			return nil, fmt.Errorf("invalid sidecar %s: %w", configuration.Name, err)
+		}
+
+		if err := validateCollisionStrategy(configuration.CollisionStrategy); err != nil {
+			return nil, fmt.Errorf("invalid sidecar %s: %w", configuration.Name, err)
+		}
+
+		if err := configuration.Placement.validate(); err != nil {
+			return nil, fmt.Errorf("invalid sidecar %s: %w", configuration.Name, err)
+		}
+
+		if err := configuration.PodPatch.validate(); err != nil {
+			return nil, fmt.Errorf("invalid sidecar %s: %w", configuration.Name, err)
+		}
+
+		for i := range configuration.Match {
+			if err := configuration.Match[i].compile(); err != nil {
+				return nil, fmt.Errorf("invalid match rule in sidecar %s: %w", configuration.Name, err)
+			}
+		}
+
+		if _, ok := mapOfSideCar[configuration.Name]; !ok {
+			order = append(order, configuration.Name)
+		}
+
+		configuration.Sidecar.templates = templates
+		mapOfSideCar[configuration.Name] = &configuration
 	}
 
-	return mapOfSideCar, nil
+	return &SideCarConfig{
+		SideCars:         mapOfSideCar,
+		Order:            order,
+		Tokens:           cfg.Tokens,
+		ResourceBounds:   cfg.ResourceBounds,
+		ImageOverride:    cfg.ImageOverride,
+		ignoreNamespaces: ignoreNamespaces,
+		onlyNamespaces:   onlyNamespaces,
+		registryMirrors:  registryMirrors,
+	}, nil
 }
 
 func (in *SideCar) DeepCopy() *SideCar {
@@ -79,5 +201,69 @@ func (in *SideCar) DeepCopy() *SideCar {
 		}
 	}
 
+	if in.AppContainerNames != nil {
+		in, out := &in.AppContainerNames, &out.AppContainerNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+
+	if in.AppContainerEnv != nil {
+		in, out := &in.AppContainerEnv, &out.AppContainerEnv
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+
+	if in.AppContainerVolumeMounts != nil {
+		in, out := &in.AppContainerVolumeMounts, &out.AppContainerVolumeMounts
+		*out = make([]corev1.VolumeMount, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+
+	if in.InitContainers != nil {
+		in, out := &in.InitContainers, &out.InitContainers
+		*out = make([]corev1.Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+
+	if in.ShareProcessNamespace != nil {
+		in, out := &in.ShareProcessNamespace, &out.ShareProcessNamespace
+		*out = new(bool)
+		**out = **in
+	}
+
+	if in.HostAliases != nil {
+		in, out := &in.HostAliases, &out.HostAliases
+		*out = make([]corev1.HostAlias, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+
+	if in.DNSConfig != nil {
+		out.DNSConfig = in.DNSConfig.DeepCopy()
+	}
+
+	if in.Labels != nil {
+		out.Labels = maps.Clone(in.Labels)
+	}
+
+	if in.Annotations != nil {
+		out.Annotations = maps.Clone(in.Annotations)
+	}
+
 	return out
 }
@@ -0,0 +1,175 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// templateFuncs is the function library available to sidecar templates
+var templateFuncs = template.FuncMap{
+	"default": func(defaultValue any, value any) any {
+		if value == nil {
+			return defaultValue
+		}
+		if v := reflect.ValueOf(value); v.IsZero() || (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.Len() == 0 {
+			return defaultValue
+		}
+		return value
+	},
+	"lower": strings.ToLower,
+	"quote": func(value any) string {
+		return strconv.Quote(fmt.Sprint(value))
+	},
+	"toJson": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// templateData is the data available to sidecar templates when rendered for a pod
+type templateData struct {
+	Pod     templatePod
+	Webhook templateWebhook
+	Tokens  map[string]string
+}
+
+type templatePod struct {
+	Name               string
+	GenerateName       string
+	Namespace          string
+	ServiceAccountName string
+	Labels             map[string]string
+	Annotations        map[string]string
+}
+
+type templateWebhook struct {
+	ShawarmaImage      string
+	NativeSidecars     bool
+	ServiceAccountName string
+	SecretTokenName    string
+}
+
+func newTemplateData(pod *corev1.Pod, namespace string, tokens map[string]string, injection *injection, mutator *Mutator) *templateData {
+	return &templateData{
+		Pod: templatePod{
+			Name:               pod.Name,
+			GenerateName:       pod.GenerateName,
+			Namespace:          namespace,
+			ServiceAccountName: pod.Spec.ServiceAccountName,
+			Labels:             pod.Labels,
+			Annotations:        pod.Annotations,
+		},
+		Webhook: templateWebhook{
+			ShawarmaImage:      mutator.shawarmaImage,
+			NativeSidecars:     injection.nativeEnabled(mutator) && mutator.nativeSidecarsSupported(),
+			ServiceAccountName: mutator.shawarmaServiceAcctName,
+			SecretTokenName:    mutator.shawarmaSecretTokenName,
+		},
+		Tokens: tokens,
+	}
+}
+
+// parseTemplates pre-parses any string field of the sidecar which contains a Go template action,
+// keyed by the original string so they may be found again when rendering.
+func parseTemplates(name string, sideCar *SideCar) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	err := visitStrings(reflect.ValueOf(sideCar), func(value string) (string, error) {
+		if _, ok := templates[value]; ok || !strings.Contains(value, "{{") {
+			return value, nil
+		}
+
+		tmpl, err := template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(value)
+		if err != nil {
+			return value, err
+		}
+
+		templates[value] = tmpl
+		return value, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid template in sidecar %s: %w", name, err)
+	}
+
+	return templates, nil
+}
+
+// renderTemplates replaces every pre-parsed template in the sidecar with its output for the given data
+func (in *SideCar) renderTemplates(data *templateData) error {
+	if len(in.templates) == 0 {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	return visitStrings(reflect.ValueOf(in), func(value string) (string, error) {
+		tmpl, ok := in.templates[value]
+		if !ok {
+			return value, nil
+		}
+
+		buffer.Reset()
+		if err := tmpl.Execute(&buffer, data); err != nil {
+			return value, err
+		}
+		return buffer.String(), nil
+	})
+}
+
+// visitStrings walks all exported string fields, slice elements and map values reachable from value,
+// replacing each with the result of visit.
+func visitStrings(value reflect.Value, visit func(string) (string, error)) error {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !value.IsNil() {
+			return visitStrings(value.Elem(), visit)
+		}
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				if err := visitStrings(value.Field(i), visit); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := visitStrings(value.Index(i), visit); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.Type().Elem().Kind() != reflect.String {
+			for iter := value.MapRange(); iter.Next(); {
+				// Map values aren't addressable, so only nested pointers may be updated
+				if err := visitStrings(iter.Value(), visit); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for iter := value.MapRange(); iter.Next(); {
+			result, err := visit(iter.Value().String())
+			if err != nil {
+				return err
+			}
+			value.SetMapIndex(iter.Key(), reflect.ValueOf(result).Convert(value.Type().Elem()))
+		}
+	case reflect.String:
+		if value.CanSet() {
+			result, err := visit(value.String())
+			if err != nil {
+				return err
+			}
+			value.SetString(result)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const (
+	imageToken     = "SHAWARMA_IMAGE"
+	tokenNameToken = "SHAWARMA_TOKEN_NAME"
+	tokenDelimiter = "|"
+)
+
+func validateTokens(tokens []Token) error {
+	names := make(map[string]bool, len(tokens))
+	for _, token := range tokens {
+		if token.Name == "" || strings.Contains(token.Name, tokenDelimiter) {
+			return fmt.Errorf("invalid token name %q", token.Name)
+		}
+		if token.Name == imageToken || token.Name == tokenNameToken {
+			return fmt.Errorf("token %s is built in and may not be redefined", token.Name)
+		}
+		if names[token.Name] {
+			return fmt.Errorf("token %s is defined more than once", token.Name)
+		}
+		names[token.Name] = true
+	}
+
+	return nil
+}
+
+// resolveTokens determines the value of each token for a pod. The default value is overridden by the
+// token's environment variable, then by the --token command line argument, then by the token's pod annotation.
+func (mutator *Mutator) resolveTokens(tokens []Token, annotations map[string]string) map[string]string {
+	values := make(map[string]string, len(tokens))
+	for _, token := range tokens {
+		value := token.Default
+		if token.Env != "" {
+			if envValue, ok := os.LookupEnv(token.Env); ok {
+				value = envValue
+			}
+		}
+		if flagValue, ok := mutator.tokens[token.Name]; ok {
+			value = flagValue
+		}
+		if token.Annotation != "" {
+			if annotationValue, ok := annotations[token.Annotation]; ok {
+				value = annotationValue
+			}
+		}
+
+		values[token.Name] = value
+	}
+
+	return values
+}
+
+// replaceTokens substitutes |NAME| tokens in every string field of the sidecar
+func (in *SideCar) replaceTokens(values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	pairs := make([]string, 0, len(values)*2)
+	for name, value := range values {
+		pairs = append(pairs, tokenDelimiter+name+tokenDelimiter, value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	return visitStrings(reflect.ValueOf(in), func(value string) (string, error) {
+		if !strings.Contains(value, tokenDelimiter) {
+			return value, nil
+		}
+		return replacer.Replace(value), nil
+	})
+}
@@ -0,0 +1,219 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	v1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// logLevels are the log levels accepted by the Shawarma sidecar
+var logLevels = sets.New("trace", "debug", "info", "warn", "warning", "error", "fatal", "panic")
+
+/*Validate function validates the Shawarma annotations of a pod or workload pod template*/
+func (mutator *Mutator) Validate(req []byte) ([]byte, error) {
+	return review(req, func(request *v1.AdmissionRequest) *v1.AdmissionResponse {
+		return validate(request, mutator)
+	})
+}
+
+func validate(req *v1.AdmissionRequest, mutator *Mutator) *v1.AdmissionResponse {
+	mutator.Logger.Info("ValidationReview",
+		zap.Any("kind", req.Kind),
+		zap.String("namespace", req.Namespace),
+		zap.String("name", req.Name),
+		zap.String("uid", string(req.UID)),
+		zap.String("operation", string(req.Operation)))
+
+	// Deletes have no object to validate
+	if len(req.Object.Raw) == 0 {
+		return &v1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: true,
+		}
+	}
+
+	metadata, fldPath, err := getPodTemplateMetadata(req)
+	if err != nil {
+		return mutator.errorResponse(req.UID, err)
+	}
+
+	if metadata == nil {
+		mutator.Logger.Debug("ValidationResponse: Unsupported kind, skipping validation",
+			zap.Any("kind", req.Kind))
+
+		return &v1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: true,
+		}
+	}
+
+	// Atomic get of the current side cars to prevent errors if they mutate while we're processing
+	sideCarConfig := mutator.GetSideCarConfig()
+
+	warnings := getAnnotationWarnings(metadata.GetAnnotations(), sideCarConfig)
+
+	errs := validateAnnotations(metadata.GetAnnotations(), sideCarConfig, fldPath.Child("metadata", "annotations"))
+	if len(errs) > 0 {
+		message := fmt.Sprintf("invalid Shawarma annotations: %v", errs.ToAggregate())
+
+		mutator.Logger.Info("ValidationResponse: Rejected",
+			zap.String("namespace", req.Namespace),
+			zap.String("name", req.Name),
+			zap.String("reason", message))
+
+		return &v1.AdmissionResponse{
+			UID:     req.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusUnprocessableEntity,
+				Reason:  metav1.StatusReasonInvalid,
+				Message: message,
+			},
+			Warnings: warnings,
+		}
+	}
+
+	return &v1.AdmissionResponse{
+		UID:      req.UID,
+		Allowed:  true,
+		Warnings: warnings,
+	}
+}
+
+// getPodTemplateMetadata returns the metadata of a pod, or of the pod template of a workload, and the path to the
+// metadata within the object. It returns nil if the kind doesn't have a pod template.
+func getPodTemplateMetadata(req *v1.AdmissionRequest) (*metav1.ObjectMeta, *field.Path, error) {
+	templatePath := field.NewPath("spec", "template")
+
+	switch req.Kind.Group + "/" + req.Kind.Kind {
+	case "/Pod":
+		var pod corev1.Pod
+		if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+			return nil, nil, err
+		}
+		return &pod.ObjectMeta, nil, nil
+	case "apps/Deployment":
+		var deployment appsv1.Deployment
+		if err := json.Unmarshal(req.Object.Raw, &deployment); err != nil {
+			return nil, nil, err
+		}
+		return &deployment.Spec.Template.ObjectMeta, templatePath, nil
+	case "apps/StatefulSet":
+		var statefulSet appsv1.StatefulSet
+		if err := json.Unmarshal(req.Object.Raw, &statefulSet); err != nil {
+			return nil, nil, err
+		}
+		return &statefulSet.Spec.Template.ObjectMeta, templatePath, nil
+	case "apps/DaemonSet":
+		var daemonSet appsv1.DaemonSet
+		if err := json.Unmarshal(req.Object.Raw, &daemonSet); err != nil {
+			return nil, nil, err
+		}
+		return &daemonSet.Spec.Template.ObjectMeta, templatePath, nil
+	case "apps/ReplicaSet":
+		var replicaSet appsv1.ReplicaSet
+		if err := json.Unmarshal(req.Object.Raw, &replicaSet); err != nil {
+			return nil, nil, err
+		}
+		return &replicaSet.Spec.Template.ObjectMeta, templatePath, nil
+	case "batch/Job":
+		var job batchv1.Job
+		if err := json.Unmarshal(req.Object.Raw, &job); err != nil {
+			return nil, nil, err
+		}
+		return &job.Spec.Template.ObjectMeta, templatePath, nil
+	case "batch/CronJob":
+		var cronJob batchv1.CronJob
+		if err := json.Unmarshal(req.Object.Raw, &cronJob); err != nil {
+			return nil, nil, err
+		}
+		return &cronJob.Spec.JobTemplate.Spec.Template.ObjectMeta, field.NewPath("spec", "jobTemplate", "spec", "template"), nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// validateAnnotations checks the values of the Shawarma annotations which are present
+func validateAnnotations(annotations map[string]string, sideCarConfig *SideCarConfig, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if value, ok := annotations[sideCarLabelInjectionAnnotation]; ok && value != "" {
+		if _, err := labels.Parse(value); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(sideCarLabelInjectionAnnotation), value, err.Error()))
+		}
+	}
+
+	if value, ok := annotations[sideCarListenPortAnnotation]; ok {
+		if port, err := strconv.Atoi(strings.TrimSpace(value)); err != nil || port < 1 || port > 65535 {
+			errs = append(errs, field.Invalid(fldPath.Key(sideCarListenPortAnnotation), value, "must be a port number between 1 and 65535"))
+		}
+	}
+
+	if value, ok := annotations[sideCarLogLevelAnnotation]; ok {
+		if !logLevels.Has(strings.ToLower(strings.TrimSpace(value))) {
+			errs = append(errs, field.NotSupported(fldPath.Key(sideCarLogLevelAnnotation), value, sets.List(logLevels)))
+		}
+	}
+
+	if value, ok := annotations[sideCarStateURLAnnotation]; ok {
+		if stateURL, err := url.Parse(strings.TrimSpace(value)); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(sideCarStateURLAnnotation), value, err.Error()))
+		} else if (stateURL.Scheme != "http" && stateURL.Scheme != "https") || stateURL.Host == "" {
+			errs = append(errs, field.Invalid(fldPath.Key(sideCarStateURLAnnotation), value, "must be an absolute http or https URL"))
+		}
+	}
+
+	for _, annotation := range []string{sideCarInjectAnnotation, sideCarNativeAnnotation} {
+		if value, ok := annotations[annotation]; ok {
+			if _, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+				errs = append(errs, field.Invalid(fldPath.Key(annotation), value, "must be true or false"))
+			}
+		}
+	}
+
+	quantities := map[string]resource.Quantity{}
+	for _, override := range resourceOverrideAnnotations {
+		if value, ok := annotations[override.annotation]; ok {
+			if quantity, err := resource.ParseQuantity(strings.TrimSpace(value)); err != nil {
+				errs = append(errs, field.Invalid(fldPath.Key(override.annotation), value, err.Error()))
+			} else {
+				quantities[override.annotation] = quantity
+			}
+		}
+	}
+
+	for _, pair := range [][2]string{
+		{sideCarCPURequestAnnotation, sideCarCPULimitAnnotation},
+		{sideCarMemoryRequestAnnotation, sideCarMemoryLimitAnnotation},
+	} {
+		request, hasRequest := quantities[pair[0]]
+		limit, hasLimit := quantities[pair[1]]
+		if hasRequest && hasLimit && request.Cmp(limit) > 0 {
+			errs = append(errs, field.Invalid(fldPath.Key(pair[0]), annotations[pair[0]],
+				fmt.Sprintf("must not be greater than %s %s", pair[1], annotations[pair[1]])))
+		}
+	}
+
+	if value, ok := annotations[sideCarInjectionImageAnnotation]; ok {
+		if err := sideCarConfig.ImageOverride.check(value); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(sideCarInjectionImageAnnotation), value, err.Error()))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateResourceOverrides(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		err         string
+	}{
+		{
+			name:        "request only",
+			annotations: map[string]string{sideCarCPURequestAnnotation: "100m"},
+		},
+		{
+			name: "request below limit",
+			annotations: map[string]string{
+				sideCarMemoryRequestAnnotation: "128Mi",
+				sideCarMemoryLimitAnnotation:   "256Mi",
+			},
+		},
+		{
+			name: "request greater than limit",
+			annotations: map[string]string{
+				sideCarCPURequestAnnotation: "100m",
+				sideCarCPULimitAnnotation:   "50m",
+			},
+			err: "must not be greater than " + sideCarCPULimitAnnotation + " 50m",
+		},
+		{
+			name:        "invalid quantity",
+			annotations: map[string]string{sideCarMemoryLimitAnnotation: "lots"},
+			err:         sideCarMemoryLimitAnnotation,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mutator := newTestMutator(t, "sidecars: []\n")
+			raw, err := json.Marshal(&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: test.annotations},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response := validate(&v1.AdmissionRequest{
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+				Namespace: "default",
+				Object:    runtime.RawExtension{Raw: raw},
+			}, mutator)
+
+			if test.err == "" {
+				if !response.Allowed {
+					t.Fatalf("expected the pod to be allowed, got %s", response.Result.Message)
+				}
+			} else if response.Allowed || !strings.Contains(response.Result.Message, test.err) {
+				t.Fatalf("expected rejection containing %q, got %+v", test.err, response.Result)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	corev1 "k8s.io/api/core/v1"
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// verifyPatch applies the patch to the pod and checks the result for common errors, so that an invalid patch is
+// rejected with a descriptive message rather than an opaque error from the API server. This isn't a replacement for
+// the API server's validation, only the fields most likely to be affected by the sidecar templates are checked.
+func verifyPatch(pod *corev1.Pod, patchBytes []byte) error {
+	document, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := jsonpatch.DecodePatch(patchBytes)
+	if err != nil {
+		return fmt.Errorf("failed to decode patch: %w", err)
+	}
+
+	if document, err = decoded.Apply(document); err != nil {
+		return fmt.Errorf("failed to apply patch: %w", err)
+	}
+
+	if err := validatePatchedPod(pod, document); err != nil {
+		return err
+	}
+
+	var patched corev1.Pod
+	if err := json.Unmarshal(document, &patched); err != nil {
+		return err
+	}
+
+	return validatePod(&patched).ToAggregate()
+}
+
+// validatePod checks the pod's labels, annotations, container names, and volumes
+func validatePod(pod *corev1.Pod) field.ErrorList {
+	var errs field.ErrorList
+
+	metadataPath := field.NewPath("metadata")
+	errs = append(errs, metav1validation.ValidateLabels(pod.Labels, metadataPath.Child("labels"))...)
+	errs = append(errs, apimachineryvalidation.ValidateAnnotations(pod.Annotations, metadataPath.Child("annotations"))...)
+
+	specPath := field.NewPath("spec")
+
+	volumes := sets.New[string]()
+	for i, volume := range pod.Spec.Volumes {
+		errs = append(errs, validateName(volume.Name, volumes, specPath.Child("volumes").Index(i).Child("name"))...)
+		volumes.Insert(volume.Name)
+	}
+
+	// Container names must be unique across all types of containers
+	containers := sets.New[string]()
+	for _, group := range []struct {
+		name       string
+		containers []corev1.Container
+	}{
+		{"initContainers", pod.Spec.InitContainers},
+		{"containers", pod.Spec.Containers},
+	} {
+		for i, container := range group.containers {
+			containerPath := specPath.Child(group.name).Index(i)
+
+			errs = append(errs, validateName(container.Name, containers, containerPath.Child("name"))...)
+			containers.Insert(container.Name)
+
+			if container.Image == "" {
+				errs = append(errs, field.Required(containerPath.Child("image"), ""))
+			}
+
+			for j, mount := range container.VolumeMounts {
+				if !volumes.Has(mount.Name) {
+					errs = append(errs, field.NotFound(containerPath.Child("volumeMounts").Index(j).Child("name"), mount.Name))
+				}
+			}
+		}
+	}
+
+	for i, container := range pod.Spec.EphemeralContainers {
+		errs = append(errs, validateName(container.Name, containers, specPath.Child("ephemeralContainers").Index(i).Child("name"))...)
+		containers.Insert(container.Name)
+	}
+
+	return errs
+}
+
+// validateName checks that a container or volume name is a valid DNS label and isn't already used
+func validateName(name string, existing sets.Set[string], fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if name == "" {
+		return append(errs, field.Required(fldPath, ""))
+	}
+
+	for _, message := range validation.IsDNS1123Label(name) {
+		errs = append(errs, field.Invalid(fldPath, name, message))
+	}
+
+	if existing.Has(name) {
+		errs = append(errs, field.Duplicate(fldPath, name))
+	}
+
+	return errs
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// serviceAccountTokenPath is where the service account token is mounted in each container
+const serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// knownAnnotations are the Shawarma annotations used by the webhook and the default sidecar templates
+var knownAnnotations = sets.New(
+	sideCarInjectionAnnotation,
+	sideCarLabelInjectionAnnotation,
+	sideCarInjectAnnotation,
+	sideCarInjectionStatusAnnotation,
+	sideCarInjectionImageAnnotation,
+	sideCarSelectionAnnotation,
+	sideCarInjectedListAnnotation,
+	sideCarNativeAnnotation,
+	sideCarModeStatusAnnotation,
+	sideCarCPURequestAnnotation,
+	sideCarCPULimitAnnotation,
+	sideCarMemoryRequestAnnotation,
+	sideCarMemoryLimitAnnotation,
+	sideCarLogLevelAnnotation,
+	sideCarStateURLAnnotation,
+	sideCarListenPortAnnotation,
+)
+
+// warn adds a warning which is returned to the client, such as kubectl, in the admission response
+func (injection *injection) warn(format string, args ...any) {
+	injection.warnings = append(injection.warnings, fmt.Sprintf(format, args...))
+}
+
+// getAnnotationWarnings returns warnings for Shawarma annotations which are likely to be mistakes, such as misspelled
+// keys. Annotations used by the configured tokens are also known.
+func getAnnotationWarnings(annotations map[string]string, sideCarConfig *SideCarConfig) []string {
+	var warnings []string
+
+	isToken := func(key string) bool {
+		return slices.ContainsFunc(sideCarConfig.Tokens, func(token Token) bool { return token.Annotation == key })
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(annotations)) {
+		if strings.HasPrefix(key, sideCarNameSpace) && !knownAnnotations.Has(key) && !isToken(key) {
+			warnings = append(warnings, fmt.Sprintf("unknown annotation %s", key))
+		}
+	}
+
+	if annotations[sideCarInjectionAnnotation] != "" && annotations[sideCarLabelInjectionAnnotation] != "" {
+		warnings = append(warnings, fmt.Sprintf("both %s and %s are set, only one should be used",
+			sideCarInjectionAnnotation, sideCarLabelInjectionAnnotation))
+	}
+
+	return warnings
+}
+
+// missingServiceAccountToken returns true if the pod doesn't mount the service account token, and a container using
+// the Shawarma image doesn't mount a token some other way
+func missingServiceAccountToken(pod *corev1.Pod, sideCar *SideCar, shawarmaImage string) bool {
+	if pod.Spec.AutomountServiceAccountToken == nil || *pod.Spec.AutomountServiceAccountToken {
+		return false
+	}
+
+	mountsToken := func(mount corev1.VolumeMount) bool { return mount.MountPath == serviceAccountTokenPath }
+	for _, containers := range [][]corev1.Container{sideCar.Containers, sideCar.InitContainers} {
+		for _, container := range containers {
+			if container.Image == shawarmaImage && !slices.ContainsFunc(container.VolumeMounts, mountsToken) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package webhook
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetAnnotationWarnings(t *testing.T) {
+	sideCarConfig := &SideCarConfig{
+		Tokens: []Token{{Name: "LOG_ENDPOINT", Annotation: "shawarma.centeredge.io/log-endpoint"}},
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    []string
+	}{
+		{
+			name: "known annotations",
+			annotations: map[string]string{
+				sideCarInjectionAnnotation:            "web",
+				sideCarLogLevelAnnotation:             "debug",
+				"shawarma.centeredge.io/log-endpoint": "http://logs",
+				"example.com/other":                   "value",
+			},
+		},
+		{
+			name:        "misspelled annotation",
+			annotations: map[string]string{"shawarma.centeredge.io/servce-name": "web"},
+			expected:    []string{"unknown annotation shawarma.centeredge.io/servce-name"},
+		},
+		{
+			name: "service name and labels",
+			annotations: map[string]string{
+				sideCarInjectionAnnotation:      "web",
+				sideCarLabelInjectionAnnotation: "app=web",
+			},
+			expected: []string{"both shawarma.centeredge.io/service-name and shawarma.centeredge.io/service-labels are set, only one should be used"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := getAnnotationWarnings(test.annotations, sideCarConfig); !slices.Equal(test.expected, actual) {
+				t.Errorf("expected warnings %q, got %q", test.expected, actual)
+			}
+		})
+	}
+}